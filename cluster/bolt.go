@@ -0,0 +1,557 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/log"
+
+	"github.com/boltdb/bolt"
+	etcdcontext "github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/etcd/client"
+)
+
+var (
+	boltKVBucket = []byte("kv")
+	// the sequence of index bucket is the index of the store.
+	boltIndexBucket = []byte("index")
+	// boltExpireBucket index the keys with TTL by the expire time,
+	// the key is the expire time(unix nanosecond) + key.
+	boltExpireBucket = []byte("expire")
+)
+
+const (
+	boltSweepInterval = time.Second
+	// boltHistorySize is the number of events kept for the watcher.
+	boltHistorySize = 1000
+)
+
+// boltClient keep data on the local boltdb in the same layout as etcd, for single node deployment.
+//
+// Every key is kept with its absolute path, the dir is kept as an entry too.
+// The expired keys are removed by the background sweeper,
+// it reads only the keys due in the expire index.
+// The recent events are kept in memory for the watcher.
+type boltClient struct {
+	db *bolt.DB
+
+	// writeMu serialize the write and publish of its events in index order.
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	index   uint64
+	history []*client.Response
+	// notify is closed and replaced when new events published.
+	notify chan struct{}
+
+	// done is closed to stop the sweeper, stopped is closed when it returned.
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// boltEntry is the value of a key or dir.
+type boltEntry struct {
+	Value    string     `json:"value,omitempty"`
+	Dir      bool       `json:"dir,omitempty"`
+	Created  uint64     `json:"created"`
+	Modified uint64     `json:"modified"`
+	Expire   *time.Time `json:"expire,omitempty"`
+}
+
+func (e *boltEntry) expired(now time.Time) bool {
+	return e.Expire != nil && !e.Expire.After(now)
+}
+
+// node return the etcd node of the entry.
+func (e *boltEntry) node(key string) *client.Node {
+	n := &client.Node{
+		Key:           key,
+		Dir:           e.Dir,
+		Value:         e.Value,
+		CreatedIndex:  e.Created,
+		ModifiedIndex: e.Modified,
+	}
+	if e.Expire != nil {
+		n.Expiration = e.Expire
+		n.TTL = int64(time.Until(*e.Expire)/time.Second) + 1
+	}
+	return n
+}
+
+// NewBoltCluster return cluster interface over the boltdb at path.
+func NewBoltCluster(dbPath string) (Inf, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	c := &boltClient{db: db, notify: make(chan struct{}), done: make(chan struct{}), stopped: make(chan struct{})}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltKVBucket); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucketIfNotExists(boltIndexBucket)
+		if err != nil {
+			return err
+		}
+		c.index = b.Sequence()
+		if tx.Bucket(boltExpireBucket) != nil {
+			return nil
+		}
+		// index the keys with TTL kept before the expire index.
+		expireBucket, err := tx.CreateBucket(boltExpireBucket)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltKVBucket).ForEach(func(k, v []byte) error {
+			var e boltEntry
+			if err := json.Unmarshal(v, &e); err != nil || e.Expire == nil {
+				return nil
+			}
+			return expireBucket.Put(expireKey(*e.Expire, string(k)), nil)
+		})
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// make the root dir, so the status can be read before any write.
+	if err := c.Set("", "", &client.SetOptions{Dir: true}); err != nil && !isErrorCode(err, client.ErrorCodeNotFile) {
+		db.Close()
+		return nil, err
+	}
+	go c.sweepLoop()
+	return c, nil
+}
+
+func isErrorCode(err error, code int) bool {
+	e, ok := err.(client.Error)
+	return ok && e.Code == code
+}
+
+// cleanKey return the absolute and clean key as etcd.
+func cleanKey(k string) string {
+	return path.Clean("/" + k)
+}
+
+func getEntry(b *bolt.Bucket, key string, now time.Time) *boltEntry {
+	v := b.Get([]byte(key))
+	if v == nil {
+		return nil
+	}
+	var e boltEntry
+	if err := json.Unmarshal(v, &e); err != nil {
+		log.Errorf("unmarshal entry %s fail: %s", key, err.Error())
+		return nil
+	}
+	if e.expired(now) {
+		return nil
+	}
+	return &e
+}
+
+// expireKey return the key of expire index, ordered by the expire time.
+func expireKey(t time.Time, key string) []byte {
+	b := make([]byte, 8+len(key))
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	copy(b[8:], key)
+	return b
+}
+
+func parseExpireKey(k []byte) (time.Time, string) {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k[:8]))), string(k[8:])
+}
+
+func putEntry(b *bolt.Bucket, key string, e boltEntry) error {
+	v, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), v)
+}
+
+// removeAll remove the key and all keys under it.
+func removeAll(b *bolt.Bucket, key string) error {
+	if err := b.Delete([]byte(key)); err != nil {
+		return err
+	}
+	prefix := []byte(strings.TrimSuffix(key, "/") + "/")
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Seek(prefix) {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update run the write fn in a transaction, and publish its events after commit.
+func (c *boltClient) update(fn func(tx *bolt.Tx, now time.Time) ([]*client.Response, error)) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	var events []*client.Response
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		events, err = fn(tx, time.Now())
+		return err
+	})
+	if err != nil || len(events) == 0 {
+		return err
+	}
+
+	c.mu.Lock()
+	c.history = append(c.history, events...)
+	if len(c.history) > boltHistorySize {
+		c.history = c.history[len(c.history)-boltHistorySize:]
+	}
+	c.index = events[len(events)-1].Index
+	close(c.notify)
+	c.notify = make(chan struct{})
+	c.mu.Unlock()
+	return nil
+}
+
+// Get return value of a key.
+func (c *boltClient) Get(k string, option *client.GetOptions) (*client.Response, error) {
+	key := config.GetConfig().Etcd.Path + "/" + k
+	return c.get(cleanKey(key), option != nil && option.Recursive)
+}
+
+// RecursiveGet return etcd/client.Response contain the node and its child nodes.
+func (c *boltClient) RecursiveGet(k string) (*client.Response, error) {
+	if !strings.HasPrefix(k, config.GetConfig().Etcd.Path) {
+		k = config.GetConfig().Etcd.Path + "/" + k
+	}
+	return c.get(cleanKey(k), true)
+}
+
+// get return the node of key, the dir node contains its children, or all descendants if recursive.
+func (c *boltClient) get(key string, recursive bool) (*client.Response, error) {
+	// read the index before the data, the watcher after it may replay the event already read,
+	// but never miss one.
+	c.mu.Lock()
+	resp := &client.Response{Action: "get", Index: c.index}
+	c.mu.Unlock()
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltKVBucket)
+		now := time.Now()
+		e := getEntry(b, key, now)
+		if e == nil {
+			return keyNotFound(key)
+		}
+		root := e.node(key)
+		if e.Dir {
+			dirs := map[string]*client.Node{key: root}
+			prefix := strings.TrimSuffix(key, "/") + "/"
+			cursor := b.Cursor()
+			for k, v := cursor.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, v = cursor.Next() {
+				childKey := string(k)
+				parent, ok := dirs[path.Dir(childKey)]
+				if !ok {
+					// the parent dir is expired, or not recursive.
+					continue
+				}
+				if !recursive && parent != root {
+					continue
+				}
+				var child boltEntry
+				if err := json.Unmarshal(v, &child); err != nil || child.expired(now) {
+					continue
+				}
+				n := child.node(childKey)
+				if child.Dir {
+					dirs[childKey] = n
+				}
+				parent.Nodes = append(parent.Nodes, n)
+			}
+		}
+		resp.Node = root
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Set set a k/v to boltdb with the SetOptions, the parent dirs are created if not exist.
+func (c *boltClient) Set(k, v string, option *client.SetOptions) error {
+	key := cleanKey(config.GetConfig().Etcd.Path + "/" + k)
+	if option == nil {
+		option = &client.SetOptions{}
+	}
+	return c.update(func(tx *bolt.Tx, now time.Time) ([]*client.Response, error) {
+		b := tx.Bucket(boltKVBucket)
+		prev := getEntry(b, key, now)
+		compare := option.PrevExist == client.PrevExist || option.PrevIndex != 0 || option.PrevValue != ""
+		switch {
+		case option.PrevExist == client.PrevNoExist && prev != nil:
+			return nil, keyExists(key)
+		case compare && prev == nil:
+			return nil, keyNotFound(key)
+		case (option.PrevIndex != 0 && prev.Modified != option.PrevIndex) ||
+			(option.PrevValue != "" && prev.Value != option.PrevValue):
+			return nil, client.Error{Code: client.ErrorCodeTestFailed, Message: "Compare failed", Cause: key}
+		case prev != nil && prev.Dir:
+			return nil, client.Error{Code: client.ErrorCodeNotFile, Message: "Not a file", Cause: key}
+		}
+
+		// make the parent dirs not exist from the top.
+		missing := make([]string, 0)
+		for dir := path.Dir(key); dir != "/"; dir = path.Dir(dir) {
+			e := getEntry(b, dir, now)
+			if e != nil && !e.Dir {
+				return nil, client.Error{Code: client.ErrorCodeNotDir, Message: "Not a directory", Cause: dir}
+			}
+			if e != nil {
+				break
+			}
+			missing = append(missing, dir)
+		}
+		indexBucket := tx.Bucket(boltIndexBucket)
+		var events []*client.Response
+		for i := len(missing) - 1; i >= 0; i-- {
+			index, err := indexBucket.NextSequence()
+			if err != nil {
+				return nil, err
+			}
+			e := boltEntry{Dir: true, Created: index, Modified: index}
+			if err := putEntry(b, missing[i], e); err != nil {
+				return nil, err
+			}
+			events = append(events, &client.Response{Action: "create", Node: e.node(missing[i]), Index: index})
+		}
+
+		index, err := indexBucket.NextSequence()
+		if err != nil {
+			return nil, err
+		}
+		e := boltEntry{Value: v, Dir: option.Dir, Created: index, Modified: index}
+		if e.Dir {
+			e.Value = ""
+		}
+		if option.TTL > 0 {
+			expire := now.Add(option.TTL)
+			e.Expire = &expire
+			// the index of the previous TTL is removed by the sweeper when due.
+			if err := tx.Bucket(boltExpireBucket).Put(expireKey(expire, key), nil); err != nil {
+				return nil, err
+			}
+		}
+		event := &client.Response{Action: "create", Index: index}
+		if prev != nil {
+			e.Created = prev.Created
+			event.Action, event.PrevNode = "set", prev.node(key)
+			if compare {
+				event.Action = "compareAndSwap"
+			}
+		}
+		if err := putEntry(b, key, e); err != nil {
+			return nil, err
+		}
+		event.Node = e.node(key)
+		return append(events, event), nil
+	})
+}
+
+// SetWithTTL set a k-v with TTL.
+func (c *boltClient) SetWithTTL(k, v string, duration time.Duration) error {
+	if duration == 0 {
+		duration = 10 * time.Minute
+	}
+	return c.Set(k, v, &client.SetOptions{TTL: duration})
+}
+
+// Remove remove a key from boltdb.
+func (c *boltClient) Remove(k string) error {
+	key := cleanKey(k) // NOTE: not add prefix
+	return c.update(func(tx *bolt.Tx, now time.Time) ([]*client.Response, error) {
+		b := tx.Bucket(boltKVBucket)
+		prev := getEntry(b, key, now)
+		if prev == nil {
+			return nil, keyNotFound(key)
+		}
+		if prev.Dir {
+			return nil, client.Error{Code: client.ErrorCodeNotFile, Message: "Not a file", Cause: key}
+		}
+		return c.remove(tx, key, prev, "delete")
+	})
+}
+
+// CompareAndRemove remove a key from boltdb if its value is prevValue.
+func (c *boltClient) CompareAndRemove(k, prevValue string) error {
+	key := cleanKey(k) // NOTE: not add prefix
+	return c.update(func(tx *bolt.Tx, now time.Time) ([]*client.Response, error) {
+		prev := getEntry(tx.Bucket(boltKVBucket), key, now)
+		switch {
+		case prev == nil:
+			return nil, keyNotFound(key)
+		case prev.Dir:
+			return nil, client.Error{Code: client.ErrorCodeNotFile, Message: "Not a file", Cause: key}
+		case prev.Value != prevValue:
+			return nil, client.Error{Code: client.ErrorCodeTestFailed, Message: "Compare failed", Cause: key}
+		}
+		return c.remove(tx, key, prev, "compareAndDelete")
+	})
+}
+
+// RemoveDir remove a dir and its child keys from boltdb.
+func (c *boltClient) RemoveDir(k string) error {
+	key := cleanKey(k) // NOTE: not add prefix
+	return c.update(func(tx *bolt.Tx, now time.Time) ([]*client.Response, error) {
+		prev := getEntry(tx.Bucket(boltKVBucket), key, now)
+		if prev == nil {
+			return nil, keyNotFound(key)
+		}
+		return c.remove(tx, key, prev, "delete")
+	})
+}
+
+// remove the key and its child keys, return the event of action.
+func (c *boltClient) remove(tx *bolt.Tx, key string, prev *boltEntry, action string) ([]*client.Response, error) {
+	index, err := tx.Bucket(boltIndexBucket).NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	if err := removeAll(tx.Bucket(boltKVBucket), key); err != nil {
+		return nil, err
+	}
+	n := &client.Node{Key: key, Dir: prev.Dir, CreatedIndex: prev.Created, ModifiedIndex: index}
+	return []*client.Response{{Action: action, Node: n, PrevNode: prev.node(key), Index: index}}, nil
+}
+
+// Mkdir make a dir to boltdb.
+func (c *boltClient) Mkdir(k string) error {
+	return c.Set(k, "", &client.SetOptions{Dir: true})
+}
+
+// Close stop the sweeper and close the boltdb.
+func (c *boltClient) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		<-c.stopped
+		err = c.db.Close()
+	})
+	return err
+}
+
+// sweepLoop remove the expired keys periodically.
+func (c *boltClient) sweepLoop() {
+	defer close(c.stopped)
+	ticker := time.NewTicker(boltSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		if err := c.sweep(); err != nil {
+			log.Errorf("sweep expired keys fail: %s", err.Error())
+		}
+	}
+}
+
+// due return whether any key in the expire index is due at now.
+func (c *boltClient) due(now time.Time) bool {
+	var due bool
+	c.db.View(func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(boltExpireBucket).Cursor().First(); k != nil {
+			expire, _ := parseExpireKey(k)
+			due = !expire.After(now)
+		}
+		return nil
+	})
+	return due
+}
+
+// sweep remove the expired keys due in the expire index and their child keys.
+// The index of the key removed or set again is dropped when due.
+func (c *boltClient) sweep() error {
+	if !c.due(time.Now()) {
+		return nil
+	}
+	return c.update(func(tx *bolt.Tx, now time.Time) ([]*client.Response, error) {
+		b := tx.Bucket(boltKVBucket)
+		var events []*client.Response
+		cursor := tx.Bucket(boltExpireBucket).Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.First() {
+			expire, key := parseExpireKey(k)
+			if expire.After(now) {
+				break
+			}
+			if err := cursor.Delete(); err != nil {
+				return nil, err
+			}
+			v := b.Get([]byte(key))
+			if v == nil {
+				// removed, or with its expired parent dir.
+				continue
+			}
+			var prev boltEntry
+			if err := json.Unmarshal(v, &prev); err != nil || !prev.expired(now) {
+				continue
+			}
+			e, err := c.remove(tx, key, &prev, "expire")
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e...)
+		}
+		return events, nil
+	})
+}
+
+// Watcher return the recursive watcher of k emitting the events after the index.
+// The watcher return ErrorCodeEventIndexCleared if the events after index is not kept.
+func (c *boltClient) Watcher(k string, afterIndex uint64) client.Watcher {
+	if !strings.HasPrefix(k, config.GetConfig().Etcd.Path) {
+		k = config.GetConfig().Etcd.Path + "/" + k
+	}
+	return &boltWatcher{c: c, key: cleanKey(k), index: afterIndex}
+}
+
+type boltWatcher struct {
+	c     *boltClient
+	key   string
+	index uint64
+}
+
+// Next blocks until the next event of the key or its child keys.
+func (w *boltWatcher) Next(ctx etcdcontext.Context) (*client.Response, error) {
+	prefix := strings.TrimSuffix(w.key, "/") + "/"
+	for {
+		w.c.mu.Lock()
+		history, index, notify := w.c.history, w.c.index, w.c.notify
+		w.c.mu.Unlock()
+
+		if w.index < index && (len(history) == 0 || history[0].Index > w.index+1) {
+			return nil, indexCleared(w.key, w.index)
+		}
+		for _, event := range history {
+			if event.Index <= w.index {
+				continue
+			}
+			w.index = event.Index
+			if event.Node.Key == w.key || strings.HasPrefix(event.Node.Key, prefix) {
+				return event, nil
+			}
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -1,11 +1,21 @@
 package cluster
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/coreos/etcd/client"
 )
 
+// ErrKeyExists is returned by Set with PrevNoExist if the key exists on every backend,
+// check it by errors.Is.
+var ErrKeyExists = errors.New("Key already exists")
+
+func keyExists(k string) error {
+	return fmt.Errorf("%w: %s", ErrKeyExists, k)
+}
+
 // Inf is the interface of etcd have.
 type Inf interface {
 	// Get return k-v from etcd.
@@ -20,6 +30,9 @@ type Inf interface {
 	// Remove k-v from etcd.
 	Remove(key string) error
 
+	// CompareAndRemove remove k-v from etcd if its value is prevValue.
+	CompareAndRemove(key, prevValue string) error
+
 	//RemoveDir remove directory from etcd.
 	RemoveDir(k string) error
 
@@ -28,6 +41,12 @@ type Inf interface {
 
 	// Mkdir make a new directory to etcd.
 	Mkdir(k string) error
+
+	// Watcher return the recursive watcher of k after the index.
+	Watcher(k string, afterIndex uint64) client.Watcher
+
+	// Close release the resources of the client.
+	Close() error
 }
 
 // NewCluster return cluster interface.
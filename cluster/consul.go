@@ -0,0 +1,667 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/log"
+
+	etcdcontext "github.com/coreos/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/coreos/etcd/client"
+)
+
+const (
+	consulKVPath        = "/v1/kv/"
+	defaultConsulTimout = 5 * time.Second
+
+	// consulWatchWait is the max wait time of the blocking query to watch.
+	consulWatchWait = time.Minute
+	// consulSweepInterval is the interval to remove the expired keys.
+	consulSweepInterval = 10 * time.Second
+)
+
+// consulClient keep data on the consul KV in the same layout as etcd.
+//
+// The dir is the key prefix, the empty dir is kept as the key ends with "/".
+// The TTL of key is kept in the flags as the expire time(unix millisecond),
+// the expired key is treated as not exist and removed when it is read,
+// the keys not read again are removed by the background sweeper,
+// and the watcher emit the expire event of them.
+// The CAS of etcd is done by the ModifyIndex of consul.
+type consulClient struct {
+	address    string
+	token      string
+	datacenter string
+	httpClient *http.Client
+
+	// watchClient is used by the blocking query, its timeout is longer than the wait.
+	watchClient *http.Client
+
+	// snapshots keep the pairs of the last recursive get of dir,
+	// the watcher after the index of snapshot diff from it.
+	mu        sync.Mutex
+	snapshots map[string]consulSnapshot
+
+	// done is closed to stop the sweeper.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type consulSnapshot struct {
+	index uint64
+	pairs []consulPair
+}
+
+// consulPair is the k-v returned by consul KV API.
+type consulPair struct {
+	Key         string
+	Value       []byte
+	Flags       uint64
+	CreateIndex uint64
+	ModifyIndex uint64
+}
+
+// expiration return the expire time of the pair, nil if has no TTL.
+func (p *consulPair) expiration() *time.Time {
+	if p.Flags == 0 {
+		return nil
+	}
+	t := time.Unix(0, int64(p.Flags)*int64(time.Millisecond))
+	return &t
+}
+
+func (p *consulPair) expired(now time.Time) bool {
+	exp := p.expiration()
+	return exp != nil && !exp.After(now)
+}
+
+// node return the etcd node of the pair.
+func (p *consulPair) node() *client.Node {
+	n := &client.Node{
+		Key:           "/" + strings.TrimSuffix(p.Key, "/"),
+		Dir:           strings.HasSuffix(p.Key, "/"),
+		Value:         string(p.Value),
+		CreatedIndex:  p.CreateIndex,
+		ModifiedIndex: p.ModifyIndex,
+	}
+	if exp := p.expiration(); exp != nil {
+		n.Expiration = exp
+		n.TTL = int64(time.Until(*exp)/time.Second) + 1
+	}
+	return n
+}
+
+// NewConsulCluster return cluster interface over consul KV HTTP API.
+// address is the consul agent address such as http://127.0.0.1:8500.
+func NewConsulCluster(address, token, datacenter string, timeout time.Duration) (Inf, error) {
+	if address == "" {
+		return nil, errors.New("consul address is empty")
+	}
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "http://" + address
+	}
+	if timeout == 0 {
+		timeout = defaultConsulTimout
+	}
+	c := &consulClient{
+		address:     strings.TrimSuffix(address, "/"),
+		token:       token,
+		datacenter:  datacenter,
+		httpClient:  &http.Client{Timeout: timeout},
+		watchClient: &http.Client{Timeout: consulWatchWait + timeout},
+		snapshots:   make(map[string]consulSnapshot),
+		done:        make(chan struct{}),
+	}
+	go c.sweepLoop(consulSweepInterval)
+	return c, nil
+}
+
+// Close stop the sweeper.
+func (c *consulClient) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+// sweepLoop remove the expired keys periodically.
+func (c *consulClient) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		if err := c.sweep(); err != nil {
+			log.Errorf("sweep expired keys fail: %s", err.Error())
+		}
+	}
+}
+
+// sweep read all keys under the etcd path, the expired keys are removed by the query.
+func (c *consulClient) sweep() error {
+	prefix := consulKey(config.GetConfig().Etcd.Path)
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+	_, err := c.list(prefix, true)
+	return err
+}
+
+// consulKey return the consul key of the etcd key, consul key has no leading "/".
+func consulKey(k string) string {
+	return strings.TrimPrefix(k, "/")
+}
+
+func keyNotFound(k string) error {
+	return client.Error{Code: client.ErrorCodeKeyNotFound, Message: "Key not found", Cause: k}
+}
+
+// do send the request to consul KV API and return the status code and body.
+func (c *consulClient) do(method, key string, params url.Values, body []byte) (int, []byte, error) {
+	code, _, b, err := c.request(context.Background(), c.httpClient, method, key, params, body)
+	return code, b, err
+}
+
+// request send the request to consul KV API by the http client,
+// return the status code, the X-Consul-Index and body.
+func (c *consulClient) request(ctx context.Context, httpClient *http.Client, method, key string, params url.Values, body []byte) (int, uint64, []byte, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	if c.datacenter != "" {
+		params.Set("dc", c.datacenter)
+	}
+	u := c.address + consulKVPath + key
+	if len(params) != 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	req = req.WithContext(ctx)
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer resp.Body.Close()
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, index, nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return resp.StatusCode, index, b, fmt.Errorf("consul %s %s fail: %d %s", method, key, resp.StatusCode, string(b))
+	}
+	return resp.StatusCode, index, b, nil
+}
+
+// list return the not expired pairs of key, all pairs with key prefix if recurse.
+// The expired pairs are removed.
+func (c *consulClient) list(key string, recurse bool) ([]consulPair, error) {
+	params := url.Values{}
+	if recurse {
+		params.Set("recurse", "true")
+	}
+	pairs, _, err := c.query(context.Background(), c.httpClient, key, params)
+	return pairs, err
+}
+
+// query GET the pairs of key by params, return the not expired pairs and the X-Consul-Index.
+// The expired pairs are removed.
+func (c *consulClient) query(ctx context.Context, httpClient *http.Client, key string, params url.Values) ([]consulPair, uint64, error) {
+	code, index, body, err := c.request(ctx, httpClient, "GET", key, params, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if code == http.StatusNotFound {
+		return nil, index, nil
+	}
+	var pairs []consulPair
+	if err := json.Unmarshal(body, &pairs); err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	output := pairs[:0]
+	for _, pair := range pairs {
+		if pair.expired(now) {
+			c.expire(pair)
+			continue
+		}
+		output = append(output, pair)
+	}
+	return output, index, nil
+}
+
+// expire remove the expired pair if it is not modified.
+func (c *consulClient) expire(pair consulPair) {
+	params := url.Values{"cas": []string{strconv.FormatUint(pair.ModifyIndex, 10)}}
+	if _, _, err := c.do("DELETE", pair.Key, params, nil); err != nil {
+		log.Errorf("remove expired key %s fail: %s", pair.Key, err.Error())
+	}
+}
+
+// keys GET the keys of prefix by params, return the keys and the X-Consul-Index.
+// The index is the max modify index of the keys with prefix, so a changed index means
+// some key with prefix is changed, without reading the values.
+func (c *consulClient) keys(ctx context.Context, httpClient *http.Client, prefix string, params url.Values) ([]string, uint64, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("keys", "true")
+	code, index, body, err := c.request(ctx, httpClient, "GET", prefix, params, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if code == http.StatusNotFound {
+		return nil, index, nil
+	}
+	var keys []string
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, 0, err
+	}
+	return keys, index, nil
+}
+
+// get return the pair of key, nil if not exist.
+func (c *consulClient) get(key string) (*consulPair, error) {
+	pairs, err := c.list(key, false)
+	if err != nil || len(pairs) == 0 {
+		return nil, err
+	}
+	return &pairs[0], nil
+}
+
+// Get return value of a key.
+func (c *consulClient) Get(k string, option *client.GetOptions) (*client.Response, error) {
+	key := config.GetConfig().Etcd.Path + "/" + k
+	if option != nil && option.Recursive {
+		return c.RecursiveGet(key)
+	}
+	pair, err := c.get(consulKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		// maybe a dir.
+		if pair, err = c.get(consulKey(key) + "/"); err != nil {
+			return nil, err
+		}
+		if pair == nil {
+			return nil, keyNotFound(key)
+		}
+	}
+	return &client.Response{Action: "get", Node: pair.node(), Index: pair.ModifyIndex}, nil
+}
+
+// RecursiveGet return etcd/client.Response contain the node and its child nodes.
+func (c *consulClient) RecursiveGet(k string) (*client.Response, error) {
+	if !strings.HasPrefix(k, config.GetConfig().Etcd.Path) {
+		k = config.GetConfig().Etcd.Path + "/" + k
+	}
+	prefix := strings.TrimSuffix(consulKey(k), "/")
+	pairs, index, err := c.query(context.Background(), c.httpClient, prefix+"/", url.Values{"recurse": []string{"true"}})
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		// not a dir, return the key itself.
+		pair, err := c.get(prefix)
+		if err != nil {
+			return nil, err
+		}
+		if pair == nil {
+			return nil, keyNotFound(k)
+		}
+		return &client.Response{Action: "get", Node: pair.node(), Index: pair.ModifyIndex}, nil
+	}
+
+	c.mu.Lock()
+	c.snapshots[prefix] = consulSnapshot{index: index, pairs: pairs}
+	c.mu.Unlock()
+
+	root := &client.Node{Key: "/" + prefix, Dir: true}
+	dirs := map[string]*client.Node{prefix: root}
+	for _, pair := range pairs {
+		rel := strings.Trim(strings.TrimPrefix(pair.Key, prefix+"/"), "/")
+		if rel == "" {
+			root.CreatedIndex, root.ModifiedIndex = pair.CreateIndex, pair.ModifyIndex
+			continue
+		}
+		// make the parent dirs of the pair.
+		parent, path := root, prefix
+		split := strings.Split(rel, "/")
+		for _, name := range split[:len(split)-1] {
+			path += "/" + name
+			dir, ok := dirs[path]
+			if !ok {
+				dir = &client.Node{Key: "/" + path, Dir: true}
+				dirs[path] = dir
+				parent.Nodes = append(parent.Nodes, dir)
+			}
+			parent = dir
+		}
+
+		n := pair.node()
+		if n.Dir {
+			if dir, ok := dirs[consulKey(n.Key)]; ok {
+				dir.CreatedIndex, dir.ModifiedIndex = n.CreatedIndex, n.ModifiedIndex
+				continue
+			}
+			dirs[consulKey(n.Key)] = n
+		}
+		parent.Nodes = append(parent.Nodes, n)
+	}
+	sortNodes(root)
+	return &client.Response{Action: "get", Node: root, Index: index}, nil
+}
+
+func sortNodes(n *client.Node) {
+	sort.Sort(n.Nodes)
+	for _, child := range n.Nodes {
+		if child.Dir {
+			sortNodes(child)
+		}
+	}
+}
+
+// Set set a k/v to consul with the SetOptions.
+// PrevExist, PrevIndex and PrevValue are checked by the ModifyIndex CAS of consul.
+func (c *consulClient) Set(k, v string, option *client.SetOptions) error {
+	key := config.GetConfig().Etcd.Path + "/" + k
+	if option == nil {
+		option = &client.SetOptions{}
+	}
+	ckey := consulKey(key)
+	if option.Dir {
+		ckey += "/"
+		v = ""
+	}
+
+	params := url.Values{}
+	var cas string
+	switch {
+	case option.PrevExist == client.PrevNoExist:
+		cas = "0"
+	case option.PrevIndex != 0 || option.PrevValue != "" || option.PrevExist == client.PrevExist:
+		pair, err := c.get(ckey)
+		if err != nil {
+			return err
+		}
+		if pair == nil {
+			return keyNotFound(key)
+		}
+		if (option.PrevIndex != 0 && pair.ModifyIndex != option.PrevIndex) ||
+			(option.PrevValue != "" && string(pair.Value) != option.PrevValue) {
+			return client.Error{Code: client.ErrorCodeTestFailed, Message: "Compare failed", Cause: key}
+		}
+		cas = strconv.FormatUint(pair.ModifyIndex, 10)
+	}
+	if cas == "0" {
+		// the expired key is treated as not exist.
+		if _, err := c.get(ckey); err != nil {
+			return err
+		}
+	}
+	if cas != "" {
+		params.Set("cas", cas)
+	}
+	if option.TTL > 0 {
+		params.Set("flags", strconv.FormatInt(time.Now().Add(option.TTL).UnixNano()/int64(time.Millisecond), 10))
+	}
+
+	_, body, err := c.do("PUT", ckey, params, []byte(v))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != "true" {
+		if cas == "0" {
+			return keyExists(key)
+		}
+		return client.Error{Code: client.ErrorCodeTestFailed, Message: "Compare failed", Cause: key}
+	}
+	return nil
+}
+
+// SetWithTTL set a k-v with TTL.
+func (c *consulClient) SetWithTTL(k, v string, duration time.Duration) error {
+	if duration == 0 {
+		duration = 10 * time.Minute
+	}
+	return c.Set(k, v, &client.SetOptions{TTL: duration})
+}
+
+// Remove remove a key from consul.
+func (c *consulClient) Remove(k string) error {
+	key := consulKey(k) // NOTE: not add prefix
+	pair, err := c.get(key)
+	if err != nil {
+		return err
+	}
+	if pair == nil {
+		return keyNotFound(k)
+	}
+	_, _, err = c.do("DELETE", key, nil, nil)
+	return err
+}
+
+// CompareAndRemove remove a key from consul if its value is prevValue,
+// by the ModifyIndex CAS of consul.
+func (c *consulClient) CompareAndRemove(k, prevValue string) error {
+	key := consulKey(k) // NOTE: not add prefix
+	pair, err := c.get(key)
+	if err != nil {
+		return err
+	}
+	if pair == nil {
+		return keyNotFound(k)
+	}
+	if string(pair.Value) != prevValue {
+		return client.Error{Code: client.ErrorCodeTestFailed, Message: "Compare failed", Cause: k}
+	}
+	params := url.Values{"cas": []string{strconv.FormatUint(pair.ModifyIndex, 10)}}
+	_, body, err := c.do("DELETE", key, params, nil)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != "true" {
+		return client.Error{Code: client.ErrorCodeTestFailed, Message: "Compare failed", Cause: k}
+	}
+	return nil
+}
+
+// RemoveDir remove a dir and its child keys from consul.
+func (c *consulClient) RemoveDir(k string) error {
+	key := strings.TrimSuffix(consulKey(k), "/") // NOTE: not add prefix
+	pairs, err := c.list(key+"/", true)
+	if err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return keyNotFound(k)
+	}
+	_, _, err = c.do("DELETE", key+"/", url.Values{"recurse": []string{"true"}}, nil)
+	return err
+}
+
+// Mkdir make a dir to consul.
+func (c *consulClient) Mkdir(k string) error {
+	return c.Set(k, "", &client.SetOptions{Dir: true})
+}
+
+// Watcher return the recursive watcher of dir k emitting the events after the index.
+// The afterIndex should be the index of the previous RecursiveGet of k,
+// otherwise the watcher return ErrorCodeEventIndexCleared to ask resync.
+func (c *consulClient) Watcher(k string, afterIndex uint64) client.Watcher {
+	if !strings.HasPrefix(k, config.GetConfig().Etcd.Path) {
+		k = config.GetConfig().Etcd.Path + "/" + k
+	}
+	prefix := strings.TrimSuffix(consulKey(k), "/")
+	w := &consulWatcher{c: c, prefix: prefix + "/", index: afterIndex}
+
+	c.mu.Lock()
+	snapshot, ok := c.snapshots[prefix]
+	c.mu.Unlock()
+	if ok && snapshot.index == afterIndex {
+		w.pairs = make(map[string]consulPair, len(snapshot.pairs))
+		w.childIndex = make(map[string]uint64)
+		for _, pair := range snapshot.pairs {
+			w.pairs[pair.Key] = pair
+			if child := w.child(pair.Key); pair.ModifyIndex > w.childIndex[child] {
+				w.childIndex[child] = pair.ModifyIndex
+			}
+		}
+	}
+	return w
+}
+
+// consulWatcher emulate the etcd recursive watcher by the consul blocking query,
+// the events are the diff of pairs between the query results.
+//
+// The blocking query only read the child keys of prefix, after it returns,
+// only the pairs of child whose index changed are read again,
+// so the change of a child such as the dedup dir not read the whole tree.
+type consulWatcher struct {
+	c      *consulClient
+	prefix string
+	index  uint64
+	// childIndex is the index of the child key or dir of prefix the pairs read at.
+	childIndex map[string]uint64
+	pairs      map[string]consulPair
+	events     []*client.Response
+}
+
+// Next blocks until the pairs under the prefix changed, and return the change one by one.
+func (w *consulWatcher) Next(ctx etcdcontext.Context) (*client.Response, error) {
+	if w.pairs == nil {
+		return nil, indexCleared(w.prefix, w.index)
+	}
+	for len(w.events) == 0 {
+		params := url.Values{
+			"separator": []string{"/"},
+			"index":     []string{strconv.FormatUint(w.index, 10)},
+			"wait":      []string{consulWatchWait.String()},
+		}
+		children, index, err := w.c.keys(ctx, w.c.watchClient, w.prefix, params)
+		if err != nil {
+			return nil, err
+		}
+		// the index of consul is reset.
+		if index < w.index {
+			return nil, indexCleared(w.prefix, w.index)
+		}
+		if err := w.update(ctx, children, index); err != nil {
+			return nil, err
+		}
+		w.index = index
+	}
+	resp := w.events[0]
+	w.events = w.events[1:]
+	return resp, nil
+}
+
+// child return the child key or dir of prefix the key belongs to, the dir ends with "/".
+func (w *consulWatcher) child(key string) string {
+	rel := strings.TrimPrefix(key, w.prefix)
+	if i := strings.Index(rel, "/"); i >= 0 {
+		return w.prefix + rel[:i+1]
+	}
+	return key
+}
+
+// isDir return the child is a dir to read recursively, the prefix itself is the key of empty dir.
+func (w *consulWatcher) isDir(child string) bool {
+	return child != w.prefix && strings.HasSuffix(child, "/")
+}
+
+// update read the pairs of the children whose index changed, and make the events of the changes.
+func (w *consulWatcher) update(ctx context.Context, children []string, index uint64) error {
+	current := make(map[string]bool, len(children))
+	for _, child := range children {
+		current[child] = true
+		_, childIndex, err := w.c.keys(ctx, w.c.httpClient, child, nil)
+		if err != nil {
+			return err
+		}
+		if prev, ok := w.childIndex[child]; ok && prev == childIndex {
+			continue
+		}
+		params := url.Values{}
+		if w.isDir(child) {
+			params.Set("recurse", "true")
+		}
+		pairs, _, err := w.c.query(ctx, w.c.httpClient, child, params)
+		if err != nil {
+			return err
+		}
+		w.diff(child, pairs, index)
+		w.childIndex[child] = childIndex
+	}
+	for child := range w.childIndex {
+		if !current[child] {
+			w.diff(child, nil, index)
+			delete(w.childIndex, child)
+		}
+	}
+	sort.Slice(w.events, func(i, j int) bool {
+		if w.events[i].Node.ModifiedIndex != w.events[j].Node.ModifiedIndex {
+			return w.events[i].Node.ModifiedIndex < w.events[j].Node.ModifiedIndex
+		}
+		return w.events[i].Node.Key < w.events[j].Node.Key
+	})
+	return nil
+}
+
+// diff make the events of the changes of the child from the previous pairs to the current.
+func (w *consulWatcher) diff(child string, pairs []consulPair, index uint64) {
+	now := time.Now()
+	current := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		// the non-recursive query may return the key of other child.
+		if w.child(pair.Key) != child {
+			continue
+		}
+		current[pair.Key] = true
+		prev, ok := w.pairs[pair.Key]
+		switch {
+		case !ok:
+			w.events = append(w.events, &client.Response{Action: "create", Node: pair.node(), Index: index})
+		case prev.ModifyIndex != pair.ModifyIndex:
+			w.events = append(w.events, &client.Response{Action: "set", Node: pair.node(), PrevNode: prev.node(), Index: index})
+		}
+		w.pairs[pair.Key] = pair
+	}
+	for key, prev := range w.pairs {
+		if current[key] || w.child(key) != child {
+			continue
+		}
+		action := "delete"
+		if prev.expired(now) {
+			action = "expire"
+		}
+		n := &client.Node{Key: "/" + strings.TrimSuffix(key, "/"), Dir: strings.HasSuffix(key, "/"), ModifiedIndex: index}
+		w.events = append(w.events, &client.Response{Action: action, Node: n, PrevNode: prev.node(), Index: index})
+		delete(w.pairs, key)
+	}
+}
+
+func indexCleared(k string, index uint64) error {
+	return client.Error{Code: client.ErrorCodeEventIndexCleared, Message: "The event in requested index is outdated and cleared", Cause: k, Index: index}
+}
@@ -0,0 +1,452 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lodastack/event/config"
+
+	"github.com/coreos/etcd/client"
+)
+
+// fakeConsul is a stub of the consul KV HTTP API, keeps the pairs in memory.
+type fakeConsul struct {
+	mu    sync.Mutex
+	index uint64
+	pairs map[string]consulPair
+	// tombstones keep the index the key deleted at, as the index of prefix.
+	tombstones map[string]uint64
+	notify     chan struct{}
+	// reads is the number of pairs read with values.
+	reads int
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{pairs: make(map[string]consulPair), tombstones: make(map[string]uint64), notify: make(chan struct{})}
+}
+
+// prefixIndex return the max index of the keys and tombstones with prefix, must be called with lock.
+func (f *fakeConsul) prefixIndex(prefix string) uint64 {
+	var index uint64
+	for k, pair := range f.pairs {
+		if strings.HasPrefix(k, prefix) && pair.ModifyIndex > index {
+			index = pair.ModifyIndex
+		}
+	}
+	for k, i := range f.tombstones {
+		if strings.HasPrefix(k, prefix) && i > index {
+			index = i
+		}
+	}
+	if index == 0 {
+		return f.index
+	}
+	return index
+}
+
+// changed bump the index and wake up the blocking queries, must be called with lock.
+func (f *fakeConsul) changed() uint64 {
+	f.index++
+	close(f.notify)
+	f.notify = make(chan struct{})
+	return f.index
+}
+
+func (f *fakeConsul) has(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.pairs[key]
+	return ok
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, consulKVPath)
+	params := r.URL.Query()
+	_, recurse := params["recurse"]
+	_, keys := params["keys"]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case "GET":
+		if index, _ := strconv.ParseUint(params.Get("index"), 10, 64); index != 0 {
+			wait, _ := time.ParseDuration(params.Get("wait"))
+			timeout := time.After(wait)
+		block:
+			for f.prefixIndex(key) <= index {
+				notify := f.notify
+				f.mu.Unlock()
+				select {
+				case <-notify:
+					f.mu.Lock()
+				case <-timeout:
+					f.mu.Lock()
+					break block
+				}
+			}
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.prefixIndex(key), 10))
+		if keys {
+			separator := params.Get("separator")
+			set := make(map[string]bool)
+			for k := range f.pairs {
+				if !strings.HasPrefix(k, key) {
+					continue
+				}
+				if i := strings.Index(strings.TrimPrefix(k, key), separator); separator != "" && i >= 0 {
+					k = key + strings.TrimPrefix(k, key)[:i+1]
+				}
+				set[k] = true
+			}
+			if len(set) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var output []string
+			for k := range set {
+				output = append(output, k)
+			}
+			sort.Strings(output)
+			json.NewEncoder(w).Encode(output)
+			return
+		}
+		var pairs []consulPair
+		for k, pair := range f.pairs {
+			if k == key || (recurse && strings.HasPrefix(k, key)) {
+				pairs = append(pairs, pair)
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+		f.reads += len(pairs)
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(pairs)
+	case "PUT":
+		prev, exist := f.pairs[key]
+		if cas := params.Get("cas"); cas != "" {
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			if (index == 0 && exist) || (index != 0 && (!exist || prev.ModifyIndex != index)) {
+				w.Write([]byte("false"))
+				return
+			}
+		}
+		value, _ := ioutil.ReadAll(r.Body)
+		flags, _ := strconv.ParseUint(params.Get("flags"), 10, 64)
+		index := f.changed()
+		pair := consulPair{Key: key, Value: value, Flags: flags, CreateIndex: index, ModifyIndex: index}
+		if exist {
+			pair.CreateIndex = prev.CreateIndex
+		}
+		f.pairs[key] = pair
+		w.Write([]byte("true"))
+	case "DELETE":
+		if cas := params.Get("cas"); cas != "" {
+			if index, _ := strconv.ParseUint(cas, 10, 64); f.pairs[key].ModifyIndex != index {
+				w.Write([]byte("false"))
+				return
+			}
+		}
+		index := f.changed()
+		for k := range f.pairs {
+			if k == key || (recurse && strings.HasPrefix(k, key)) {
+				delete(f.pairs, k)
+				f.tombstones[k] = index
+			}
+		}
+		w.Write([]byte("true"))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestConsul(t *testing.T) (*consulClient, *fakeConsul, func()) {
+	config.GetConfig().Etcd.Path = "/event"
+	fake := newFakeConsul()
+	srv := httptest.NewServer(fake)
+	c, err := NewConsulCluster(srv.URL, "", "", time.Second)
+	if err != nil {
+		srv.Close()
+		t.Fatalf("new consul cluster: %s", err)
+	}
+	return c.(*consulClient), fake, func() {
+		c.(*consulClient).Close()
+		srv.Close()
+	}
+}
+
+func TestConsulGetSet(t *testing.T) {
+	c, _, closeFn := newTestConsul(t)
+	defer closeFn()
+
+	if _, err := c.Get("ns/k", nil); !isErrorCode(err, client.ErrorCodeKeyNotFound) {
+		t.Fatalf("get not exist key: %v", err)
+	}
+	if err := c.Set("ns/k", "v", nil); err != nil {
+		t.Fatalf("set: %s", err)
+	}
+	resp, err := c.Get("ns/k", nil)
+	if err != nil {
+		t.Fatalf("get: %s", err)
+	}
+	if resp.Node.Key != "/event/ns/k" || resp.Node.Value != "v" || resp.Node.Dir {
+		t.Fatalf("unexpected node: %+v", resp.Node)
+	}
+
+	if err := c.Mkdir("ns/dir"); err != nil {
+		t.Fatalf("mkdir: %s", err)
+	}
+	if resp, err = c.Get("ns/dir", nil); err != nil || !resp.Node.Dir {
+		t.Fatalf("get dir: %v %+v", err, resp)
+	}
+	if err := c.Remove("/event/ns/k"); err != nil {
+		t.Fatalf("remove: %s", err)
+	}
+	if _, err := c.Get("ns/k", nil); !isErrorCode(err, client.ErrorCodeKeyNotFound) {
+		t.Fatalf("get removed key: %v", err)
+	}
+}
+
+func TestConsulSetCAS(t *testing.T) {
+	c, _, closeFn := newTestConsul(t)
+	defer closeFn()
+
+	if err := c.Set("k", "v1", &client.SetOptions{PrevExist: client.PrevNoExist}); err != nil {
+		t.Fatalf("create: %s", err)
+	}
+	if err := c.Set("k", "v2", &client.SetOptions{PrevExist: client.PrevNoExist}); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("create exist key: %v", err)
+	}
+	resp, err := c.Get("k", nil)
+	if err != nil {
+		t.Fatalf("get: %s", err)
+	}
+	if err := c.Set("k", "v2", &client.SetOptions{PrevIndex: resp.Node.ModifiedIndex + 1}); !isErrorCode(err, client.ErrorCodeTestFailed) {
+		t.Fatalf("set by stale index: %v", err)
+	}
+	if err := c.Set("k", "v2", &client.SetOptions{PrevValue: "v0"}); !isErrorCode(err, client.ErrorCodeTestFailed) {
+		t.Fatalf("set by wrong value: %v", err)
+	}
+	if err := c.Set("k", "v2", &client.SetOptions{PrevIndex: resp.Node.ModifiedIndex}); err != nil {
+		t.Fatalf("set by index: %s", err)
+	}
+	if err := c.Set("k", "v3", &client.SetOptions{PrevValue: "v2"}); err != nil {
+		t.Fatalf("set by value: %s", err)
+	}
+	if err := c.Set("other", "v", &client.SetOptions{PrevExist: client.PrevExist}); !isErrorCode(err, client.ErrorCodeKeyNotFound) {
+		t.Fatalf("update not exist key: %v", err)
+	}
+	if resp, err = c.Get("k", nil); err != nil || resp.Node.Value != "v3" {
+		t.Fatalf("get: %v %+v", err, resp)
+	}
+
+	if err := c.CompareAndRemove("/event/k", "v2"); !isErrorCode(err, client.ErrorCodeTestFailed) {
+		t.Fatalf("remove by wrong value: %v", err)
+	}
+	if err := c.CompareAndRemove("/event/k", "v3"); err != nil {
+		t.Fatalf("remove by value: %s", err)
+	}
+	if err := c.CompareAndRemove("/event/k", "v3"); !isErrorCode(err, client.ErrorCodeKeyNotFound) {
+		t.Fatalf("remove not exist key: %v", err)
+	}
+}
+
+func TestConsulTTL(t *testing.T) {
+	c, fake, closeFn := newTestConsul(t)
+	defer closeFn()
+
+	if err := c.SetWithTTL("read", "v", 50*time.Millisecond); err != nil {
+		t.Fatalf("set read: %s", err)
+	}
+	if err := c.SetWithTTL("unread", "v", 50*time.Millisecond); err != nil {
+		t.Fatalf("set unread: %s", err)
+	}
+	resp, err := c.Get("read", nil)
+	if err != nil {
+		t.Fatalf("get: %s", err)
+	}
+	if resp.Node.Expiration == nil || resp.Node.TTL <= 0 {
+		t.Fatalf("no TTL: %+v", resp.Node)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	// the expired key is not exist and can be created again.
+	if _, err := c.Get("read", nil); !isErrorCode(err, client.ErrorCodeKeyNotFound) {
+		t.Fatalf("get expired key: %v", err)
+	}
+	if err := c.Set("read", "v", &client.SetOptions{PrevExist: client.PrevNoExist}); err != nil {
+		t.Fatalf("create expired key: %s", err)
+	}
+
+	// the key not read again is removed by the sweeper.
+	if !fake.has("event/unread") {
+		t.Fatal("expired key is removed before sweep")
+	}
+	if err := c.sweep(); err != nil {
+		t.Fatalf("sweep: %s", err)
+	}
+	if fake.has("event/unread") {
+		t.Fatal("expired key is not removed by sweep")
+	}
+}
+
+func TestConsulRecursiveGet(t *testing.T) {
+	c, _, closeFn := newTestConsul(t)
+	defer closeFn()
+
+	for _, k := range []string{"ns/a/h1", "ns/a/h2", "ns/b"} {
+		if err := c.Set(k, k, nil); err != nil {
+			t.Fatalf("set %s: %s", k, err)
+		}
+	}
+	if err := c.Mkdir("ns/empty"); err != nil {
+		t.Fatalf("mkdir: %s", err)
+	}
+
+	resp, err := c.RecursiveGet("ns")
+	if err != nil {
+		t.Fatalf("recursive get: %s", err)
+	}
+	root := resp.Node
+	if root.Key != "/event/ns" || !root.Dir || len(root.Nodes) != 3 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	a, b, empty := root.Nodes[0], root.Nodes[1], root.Nodes[2]
+	if a.Key != "/event/ns/a" || !a.Dir || len(a.Nodes) != 2 ||
+		a.Nodes[0].Key != "/event/ns/a/h1" || a.Nodes[1].Value != "ns/a/h2" {
+		t.Fatalf("unexpected dir a: %+v", a)
+	}
+	if b.Key != "/event/ns/b" || b.Dir || b.Value != "ns/b" {
+		t.Fatalf("unexpected key b: %+v", b)
+	}
+	if empty.Key != "/event/ns/empty" || !empty.Dir || len(empty.Nodes) != 0 {
+		t.Fatalf("unexpected empty dir: %+v", empty)
+	}
+
+	if err := c.RemoveDir("/event/ns/a"); err != nil {
+		t.Fatalf("remove dir: %s", err)
+	}
+	if resp, err = c.RecursiveGet("ns"); err != nil || len(resp.Node.Nodes) != 2 {
+		t.Fatalf("recursive get after remove dir: %v %+v", err, resp)
+	}
+	if _, err := c.RecursiveGet("other"); !isErrorCode(err, client.ErrorCodeKeyNotFound) {
+		t.Fatalf("recursive get not exist dir: %v", err)
+	}
+}
+
+func TestConsulWatcher(t *testing.T) {
+	c, _, closeFn := newTestConsul(t)
+	defer closeFn()
+
+	if err := c.Set("ns/a", "1", nil); err != nil {
+		t.Fatalf("set: %s", err)
+	}
+	resp, err := c.RecursiveGet("ns")
+	if err != nil {
+		t.Fatalf("recursive get: %s", err)
+	}
+
+	// the watcher not after the snapshot ask resync.
+	if _, err := c.Watcher("ns", resp.Index-1).Next(context.Background()); !isErrorCode(err, client.ErrorCodeEventIndexCleared) {
+		t.Fatalf("watch without snapshot: %v", err)
+	}
+
+	w := c.Watcher("ns", resp.Index)
+	next := func(action, key, value string) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		event, err := w.Next(ctx)
+		if err != nil {
+			t.Fatalf("next %s %s: %s", action, key, err)
+		}
+		if event.Action != action || event.Node.Key != key || event.Node.Value != value {
+			t.Fatalf("expect %s %s %q, got %s %s %q", action, key, value, event.Action, event.Node.Key, event.Node.Value)
+		}
+	}
+
+	if err := c.Set("ns/b", "2", nil); err != nil {
+		t.Fatalf("set: %s", err)
+	}
+	next("create", "/event/ns/b", "2")
+	if err := c.Set("ns/a", "3", nil); err != nil {
+		t.Fatalf("set: %s", err)
+	}
+	next("set", "/event/ns/a", "3")
+	if err := c.Remove("/event/ns/b"); err != nil {
+		t.Fatalf("remove: %s", err)
+	}
+	next("delete", "/event/ns/b", "")
+
+	if err := c.SetWithTTL("ns/ttl", "4", 50*time.Millisecond); err != nil {
+		t.Fatalf("set with TTL: %s", err)
+	}
+	next("create", "/event/ns/ttl", "4")
+	time.Sleep(100 * time.Millisecond)
+	if err := c.sweep(); err != nil {
+		t.Fatalf("sweep: %s", err)
+	}
+	next("expire", "/event/ns/ttl", "")
+}
+
+func TestConsulWatcherReadChangedChild(t *testing.T) {
+	c, fake, closeFn := newTestConsul(t)
+	defer closeFn()
+
+	for _, k := range []string{"ns/a/1", "ns/a/2", "ns/b/1", "ns/c"} {
+		if err := c.Set(k, k, nil); err != nil {
+			t.Fatalf("set %s: %s", k, err)
+		}
+	}
+	resp, err := c.RecursiveGet("ns")
+	if err != nil {
+		t.Fatalf("recursive get: %s", err)
+	}
+	w := c.Watcher("ns", resp.Index)
+
+	fake.mu.Lock()
+	fake.reads = 0
+	fake.mu.Unlock()
+	if err := c.Set("ns/b/2", "2", nil); err != nil {
+		t.Fatalf("set: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	event, err := w.Next(ctx)
+	if err != nil {
+		t.Fatalf("next: %s", err)
+	}
+	if event.Action != "create" || event.Node.Key != "/event/ns/b/2" {
+		t.Fatalf("unexpected event: %s %s", event.Action, event.Node.Key)
+	}
+	fake.mu.Lock()
+	reads := fake.reads
+	fake.mu.Unlock()
+	// only the pairs of the changed dir b are read.
+	if reads != 2 {
+		t.Fatalf("expect read 2 pairs, got %d", reads)
+	}
+
+	if err := c.RemoveDir("/event/ns/a"); err != nil {
+		t.Fatalf("remove dir: %s", err)
+	}
+	for _, key := range []string{"/event/ns/a/1", "/event/ns/a/2"} {
+		if event, err = w.Next(ctx); err != nil {
+			t.Fatalf("next: %s", err)
+		}
+		if event.Action != "delete" || event.Node.Key != key {
+			t.Fatalf("expect delete %s, got %s %s", key, event.Action, event.Node.Key)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/metrics"
 
 	"github.com/coreos/etcd/client"
 )
@@ -25,6 +26,7 @@ type etcdClient struct {
 // Get return value of a key.
 func (c *etcdClient) Get(k string, option *client.GetOptions) (*client.Response, error) {
 	key := config.GetConfig().Etcd.Path + "/" + k
+	defer metrics.EtcdDuration.Since(time.Now(), "get")
 	return c.kapi.Get(context.Background(), key, option)
 }
 
@@ -34,13 +36,26 @@ func (c *etcdClient) RecursiveGet(k string) (*client.Response, error) {
 		k = config.GetConfig().Etcd.Path + "/" + k
 	}
 
+	defer metrics.EtcdDuration.Since(time.Now(), "recursiveget")
 	return c.kapi.Get(context.Background(), k, &client.GetOptions{Recursive: true})
 }
 
+// Watcher return the recursive watcher of dir k emitting the events after the index.
+func (c *etcdClient) Watcher(k string, afterIndex uint64) client.Watcher {
+	if !strings.HasPrefix(k, config.GetConfig().Etcd.Path) {
+		k = config.GetConfig().Etcd.Path + "/" + k
+	}
+	return c.kapi.Watcher(k, &client.WatcherOptions{AfterIndex: afterIndex, Recursive: true})
+}
+
 // Set set a k/v to etcd with the SetOptions.
 func (c *etcdClient) Set(k, v string, option *client.SetOptions) error {
 	key := config.GetConfig().Etcd.Path + "/" + k
+	defer metrics.EtcdDuration.Since(time.Now(), "set")
 	_, err := c.kapi.Set(context.Background(), key, v, option)
+	if e, ok := err.(client.Error); ok && e.Code == client.ErrorCodeNodeExist {
+		return keyExists(key)
+	}
 	return err
 }
 
@@ -50,6 +65,7 @@ func (c *etcdClient) SetWithTTL(k, v string, duration time.Duration) error {
 	if duration == 0 {
 		duration = 10 * time.Minute
 	}
+	defer metrics.EtcdDuration.Since(time.Now(), "setwithttl")
 	_, err := c.kapi.Set(context.Background(), key, v, &client.SetOptions{TTL: duration})
 	return err
 }
@@ -57,13 +73,23 @@ func (c *etcdClient) SetWithTTL(k, v string, duration time.Duration) error {
 // Remove remove a key from etcd.
 func (c *etcdClient) Remove(k string) error {
 	key := k // NOTE: not add prefix
+	defer metrics.EtcdDuration.Since(time.Now(), "remove")
 	_, err := c.kapi.Delete(context.Background(), key, nil)
 	return err
 }
 
+// CompareAndRemove remove a key from etcd if its value is prevValue.
+func (c *etcdClient) CompareAndRemove(k, prevValue string) error {
+	key := k // NOTE: not add prefix
+	defer metrics.EtcdDuration.Since(time.Now(), "compareandremove")
+	_, err := c.kapi.Delete(context.Background(), key, &client.DeleteOptions{PrevValue: prevValue})
+	return err
+}
+
 // RemoveDir remove a dir from etcd.
 func (c *etcdClient) RemoveDir(k string) error {
 	key := k // NOTE: not add prefix
+	defer metrics.EtcdDuration.Since(time.Now(), "removedir")
 	_, err := c.kapi.Delete(context.Background(), key, &client.DeleteOptions{Dir: true, Recursive: true})
 	return err
 }
@@ -72,3 +98,8 @@ func (c *etcdClient) RemoveDir(k string) error {
 func (c *etcdClient) Mkdir(k string) error {
 	return c.Set(k, k, &client.SetOptions{Dir: true})
 }
+
+// Close do nothing, the etcd client has no resource to release.
+func (c *etcdClient) Close() error {
+	return nil
+}
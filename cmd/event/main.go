@@ -1,20 +1,29 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/lodastack/event/cluster"
 	"github.com/lodastack/event/config"
 	"github.com/lodastack/event/loda"
+	"github.com/lodastack/event/output"
+	"github.com/lodastack/event/output/tmpl"
 	"github.com/lodastack/event/query"
 	"github.com/lodastack/event/work"
 
 	"github.com/lodastack/log"
 )
 
+// defaultShutdownTimeout is the max time to drain the in-flight work on shutdown if not configured.
+const defaultShutdownTimeout = 30 * time.Second
+
 func initLog(conf config.LogConfig) {
 	if !conf.Enable {
 		fmt.Println("log to std err")
@@ -45,16 +54,73 @@ func init() {
 
 func main() {
 	fmt.Printf("build via golang version: %s\n", runtime.Version())
-	c, err := cluster.NewCluster(config.GetConfig().Etcd.Endpoints,
-		config.GetConfig().Etcd.Auth, config.GetConfig().Etcd.Username, config.GetConfig().Etcd.Password, 5, 5)
+	var c cluster.Inf
+	var err error
+	switch backend := config.GetConfig().Cluster.Backend; backend {
+	case "", "etcd":
+		c, err = cluster.NewCluster(config.GetConfig().Etcd.Endpoints,
+			config.GetConfig().Etcd.Auth, config.GetConfig().Etcd.Username, config.GetConfig().Etcd.Password, 5, 5)
+	case "consul":
+		conf := config.GetConfig().Consul
+		c, err = cluster.NewConsulCluster(conf.Address, conf.Token, conf.Datacenter,
+			time.Duration(conf.Timeout)*time.Second)
+	case "bolt":
+		c, err = cluster.NewBoltCluster(config.GetConfig().Bolt.Path)
+	default:
+		err = fmt.Errorf("unknown cluster backend %s", backend)
+	}
 	if err != nil {
 		fmt.Printf("NewCluster error: %s\n", err.Error())
 		return
 	}
 
-	go loda.UpdateOffMachineLoop()
-	go loda.UpdateAlarmsFromLoda()
-	w := work.NewWork(c)
-	go query.Start(w)
-	select {}
+	ctx, cancel := context.WithCancel(context.Background())
+	go loda.UpdateOffMachineLoop(ctx)
+	go loda.UpdateAlarmsFromLoda(ctx)
+	go tmpl.ReloadLoop(ctx)
+	w := work.NewWork(ctx, c)
+	query.Start(ctx, w)
+
+	// reload the config on SIGHUP, shutdown on SIGINT and SIGTERM.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for s := range sig {
+		if s == syscall.SIGHUP {
+			if err := config.Reload(); err != nil {
+				log.Errorf("reload config on %s fail: %s", s, err.Error())
+			}
+			continue
+		}
+		log.Infof("receive signal %s, shutdown", s)
+		break
+	}
+	signal.Stop(sig)
+	shutdown(cancel, w)
+}
+
+// shutdown stop accepting events and drain the in-flight work until the shutdown timeout,
+// then stop the background loops, which the in-flight events depend on.
+func shutdown(cancel context.CancelFunc, w *work.Work) {
+	timeout := time.Duration(config.GetConfig().Com.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, stop := context.WithTimeout(context.Background(), timeout)
+	defer stop()
+
+	drained := query.Shutdown(ctx)
+	output.Shutdown(ctx)
+	cancel()
+	if drained {
+		w.Close()
+	} else {
+		// the running consumers still use the cluster and history.
+		log.Errorf("event queue consumers are running, not close the cluster and history")
+	}
+	if ctx.Err() != nil {
+		log.Errorf("shutdown exceed %s, the in-flight work is abandoned", timeout)
+	} else {
+		log.Info("shutdown finished")
+	}
+	log.Close()
 }
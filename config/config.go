@@ -2,7 +2,6 @@ package config
 
 import (
 	"io/ioutil"
-	"os"
 	"sync"
 	"time"
 
@@ -15,21 +14,39 @@ var (
 	mux        = new(sync.RWMutex)
 	config     = new(Config)
 	configPath = ""
+
+	// reloadMu serialize the reloads.
+	reloadMu sync.Mutex
 )
 
 type Config struct {
-	Com    CommonConfig   `toml:"common"`
-	Reg    RegistryConfig `toml:"registry"`
-	Etcd   EtcdConfig     `toml:"etcd"`
-	Mail   MailConfig     `toml:"mail"`
-	Sms    SmsConfig      `toml:"sms"`
-	Wechat WechatConfig   `toml""wechat"`
-	Log    LogConfig      `toml:"log"`
-	Render RenderConfig   `toml:"render"`
+	Com     CommonConfig   `toml:"common"`
+	Reg     RegistryConfig `toml:"registry"`
+	Etcd    EtcdConfig     `toml:"etcd"`
+	Mail    MailConfig     `toml:"mail"`
+	Sms     SmsConfig      `toml:"sms"`
+	Wechat  WechatConfig   `toml:"wechat"`
+	Webhook WebhookConfig  `toml:"webhook"`
+	Queue   QueueConfig    `toml:"queue"`
+	Log     LogConfig      `toml:"log"`
+	Render  RenderConfig   `toml:"render"`
+
+	// Pool is the worker pool config of every output channel.
+	Pool        map[string]PoolConfig `toml:"pool"`
+	Convergence ConvergenceConfig     `toml:"convergence"`
+	Flap        FlapConfig            `toml:"flap"`
+	Template    TemplateConfig        `toml:"template"`
+	I18n        I18nConfig            `toml:"i18n"`
+	Cluster     ClusterConfig         `toml:"cluster"`
+	Consul      ConsulConfig          `toml:"consul"`
+	Bolt        BoltConfig            `toml:"bolt"`
+	History     HistoryConfig         `toml:"history"`
 
 	EtcdConfig client.Config `toml:"-"`
 }
 type EtcdConfig struct {
+	// Addr is the member identity of this instance in cluster.
+	Addr          string        `toml:"addr"`
 	Auth          bool          `toml:"auth"`
 	Username      string        `toml:"username"`
 	Password      string        `toml:"password"`
@@ -37,6 +54,25 @@ type EtcdConfig struct {
 	HeaderTimeout time.Duration `toml:"timeout"`
 	Path          string        `toml:"path"`
 }
+
+// ClusterConfig select the backend keeping the status, etcd, consul or bolt.
+type ClusterConfig struct {
+	Backend string `toml:"backend"`
+}
+
+// ConsulConfig is the consul KV backend config, key prefix is the etcd path.
+type ConsulConfig struct {
+	Address    string `toml:"address"`
+	Token      string `toml:"token"`
+	Datacenter string `toml:"datacenter"`
+	Timeout    int    `toml:"timeout"` // unit: second
+}
+
+// BoltConfig is the local boltdb backend config for single node.
+type BoltConfig struct {
+	Path string `toml:"path"`
+}
+
 type MailConfig struct {
 	User string `toml:"user"`
 	Pwd  string `toml:"pwd"`
@@ -45,7 +81,7 @@ type MailConfig struct {
 	From string `toml:"from"`
 
 	MailSuffix    string `toml:"mailsuffix"`
-	SubjectPrefix string `toml:subjectprefix`
+	SubjectPrefix string `toml:"subjectprefix"`
 }
 
 type RenderConfig struct {
@@ -55,11 +91,83 @@ type RenderConfig struct {
 }
 
 type SmsConfig struct {
-	Script string `toml:script`
+	Script string `toml:"script"`
 }
 
 type WechatConfig struct {
-	Script string `toml:script`
+	Script string `toml:"script"`
+}
+
+type WebhookConfig struct {
+	// Secret is the HMAC-SHA256 key used to sign the payload.
+	Secret  string `toml:"secret"`
+	Timeout int    `toml:"timeout"` // unit: second
+	Retry   int    `toml:"retry"`   // default 3, negative to not retry
+	Backoff int    `toml:"backoff"` // unit: millisecond
+}
+
+type QueueConfig struct {
+	// Path is the boltdb file of the event queue, handle event synchronously if empty.
+	Path        string `toml:"path"`
+	Workers     int    `toml:"workers"`
+	MaxAttempts int    `toml:"maxattempts"`
+}
+
+// HistoryConfig is the local store of status transitions, not keep history if path is empty.
+type HistoryConfig struct {
+	Path       string `toml:"path"`
+	Retention  int    `toml:"retention"` // unit: day
+	MaxRecords int    `toml:"maxrecords"`
+}
+
+type PoolConfig struct {
+	Workers int `toml:"workers"`
+	Queue   int `toml:"queue"`
+	// Policy is the overflow policy: dropoldest, reject or spill.
+	Policy string `toml:"policy"`
+}
+
+type ConvergenceConfig struct {
+	// Window is the default convergence window, disable convergence if 0.
+	Window int `toml:"window"` // unit: second
+	// GroupBy is the default grouping key: ns, alarm or host.
+	GroupBy string `toml:"groupby"`
+
+	Rules []ConvergenceRule `toml:"rule"`
+}
+
+// ConvergenceRule is the convergence policy of the ns(and its child ns) or alarm.
+type ConvergenceRule struct {
+	Ns      string `toml:"ns"`
+	Alarm   string `toml:"alarm"` // alarm name
+	Window  int    `toml:"window"`
+	GroupBy string `toml:"groupby"`
+}
+
+type FlapConfig struct {
+	// Window is the sliding window to count the level transitions.
+	Window int `toml:"window"` // unit: second
+	// Threshold is the transitions in window to mark the status flapping, disable flap detection if 0.
+	Threshold int `toml:"threshold"`
+	// Recover is the transitions in window below which the flapping status is stable, default threshold/2.
+	Recover int `toml:"recover"`
+}
+
+type TemplateConfig struct {
+	// Dir keep the template files named as <channel>.<kind>.tmpl, use the default layout if empty.
+	Dir string `toml:"dir"`
+	// Interval is the interval to reload the changed templates.
+	Interval int `toml:"interval"` // unit: second
+}
+
+type I18nConfig struct {
+	// Default is the global default locale: en-US or zh-CN.
+	// If empty, wechat is in zh-CN and the other channels in en-US.
+	Default string `toml:"default"`
+	// Users is the locale of users, override the locale of user record in registry.
+	Users map[string]string `toml:"users"`
+	// Ns is the locale of the ns and its child ns.
+	Ns map[string]string `toml:"ns"`
 }
 
 type CommonConfig struct {
@@ -68,6 +176,15 @@ type CommonConfig struct {
 	HiddenMetricSuffix string `toml:"hiddenMetricSuffix"`
 
 	EventLogNs string `toml:"eventLogNs"`
+
+	// SpillDir keep the notify spilled by the full output pools.
+	SpillDir string `toml:"spillDir"`
+
+	// TimeZone is the IANA time zone name the alarm active window is in, use local if empty.
+	TimeZone string `toml:"timeZone"`
+
+	// ShutdownTimeout is the max time to drain the in-flight work on shutdown, unit: second.
+	ShutdownTimeout int `toml:"shutdownTimeout"`
 }
 
 type LogConfig struct {
@@ -83,28 +200,63 @@ type RegistryConfig struct {
 	ExpireDur int    `toml:"expireDur"`
 }
 
-func Reload() {
-	err := LoadConfig(configPath)
+// Reload parse the config file into a fresh Config, and swap the current config if it is valid,
+// otherwise keep the current config and return the error. The settings only taking effect
+// on startup are kept as current, the log level is applied on reload.
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	mux.RLock()
+	path, old := configPath, config
+	mux.RUnlock()
+
+	c, err := decodeFile(path)
 	if err != nil {
-		os.Exit(1)
+		return err
+	}
+	if err = c.Validate(); err != nil {
+		log.Errorf("reload config %s fail, keep the current config: %s", path, err.Error())
+		return err
+	}
+	for _, name := range keepStatic(old, c) {
+		log.Warningf("config %s is changed, restart to take effect", name)
+	}
+
+	mux.Lock()
+	config = c
+	mux.Unlock()
+	if c.Log.Level != "" {
+		log.SetSeverity(c.Log.Level)
 	}
+	log.Infof("reload config %s", path)
+	return nil
 }
 
 func LoadConfig(path string) (err error) {
+	c, err := decodeFile(path)
+	if err != nil {
+		return err
+	}
 	mux.Lock()
 	defer mux.Unlock()
-	configPath = path
+	configPath, config = path, c
+	return nil
+}
+
+// decodeFile parse the config file into a fresh Config.
+func decodeFile(path string) (*Config, error) {
 	configFile, err := ioutil.ReadFile(path)
 	if err != nil {
 		log.Errorf("Error while loading config %s.\n%s\n", path, err.Error())
-		return
+		return nil, err
 	}
-	if _, err = toml.Decode(string(configFile), &config); err != nil {
+	c := new(Config)
+	if _, err = toml.Decode(string(configFile), c); err != nil {
 		log.Errorf("Error while decode the config %s.\n%s\n", path, err.Error())
-		return
-	} else {
-		return nil
+		return nil, err
 	}
+	return c, nil
 }
 
 func GetConfig() *Config {
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// logLevels is the log levels supported.
+var logLevels = []string{"DEBUG", "INFO", "WARNING", "ERROR", "FATAL"}
+
+// Validate check the config, return all the invalid settings in one error.
+func (c *Config) Validate() error {
+	var errs []string
+	if err := validateListen(c.Com.Listen); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if c.Cluster.Backend == "" || c.Cluster.Backend == "etcd" {
+		if len(c.Etcd.Endpoints) == 0 {
+			errs = append(errs, "etcd endpoints is empty")
+		}
+		for _, endpoint := range c.Etcd.Endpoints {
+			if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Sprintf("invalid etcd endpoint %q", endpoint))
+			}
+		}
+	}
+	// mail is optional, but the host and port are required together.
+	if c.Mail.Host != "" || c.Mail.Port != 0 {
+		if c.Mail.Host == "" {
+			errs = append(errs, "mail host is empty")
+		}
+		if c.Mail.Port < 1 || c.Mail.Port > 65535 {
+			errs = append(errs, fmt.Sprintf("invalid mail port %d", c.Mail.Port))
+		}
+	}
+	for name, path := range map[string]string{"sms script": c.Sms.Script, "wechat script": c.Wechat.Script} {
+		if err := validatePath(path, false); err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+	for name, path := range map[string]string{"render phantomdir": c.Render.PhantomDir, "render imgdir": c.Render.ImgDir} {
+		if err := validatePath(path, true); err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+	if c.Log.Level != "" {
+		valid := false
+		for _, level := range logLevels {
+			valid = valid || level == c.Log.Level
+		}
+		if !valid {
+			errs = append(errs, fmt.Sprintf("invalid log level %q", c.Log.Level))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	// keep the error stable, the map above is not ordered.
+	sort.Strings(errs)
+	return errors.New("invalid config: " + strings.Join(errs, "; "))
+}
+
+func validateListen(listen string) error {
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %s", listen, err.Error())
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return fmt.Errorf("invalid listen port %q", port)
+	}
+	return nil
+}
+
+// validatePath check the path exist and is dir or file as expected, empty path is not configured.
+func validatePath(path string, dir bool) error {
+	if path == "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() != dir {
+		if dir {
+			return fmt.Errorf("%s is not a directory", path)
+		}
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// keepStatic keep the settings of c which only take effect on startup as old,
+// return the names of the settings changed.
+func keepStatic(old, c *Config) []string {
+	static := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"common.listen", &old.Com.Listen, &c.Com.Listen},
+		{"common.spillDir", &old.Com.SpillDir, &c.Com.SpillDir},
+		{"etcd", &old.Etcd, &c.Etcd},
+		{"cluster", &old.Cluster, &c.Cluster},
+		{"consul", &old.Consul, &c.Consul},
+		{"bolt", &old.Bolt, &c.Bolt},
+		{"queue", &old.Queue, &c.Queue},
+		{"history", &old.History, &c.History},
+		{"pool", &old.Pool, &c.Pool},
+		{"log.enable", &old.Log.Enable, &c.Log.Enable},
+		{"log.path", &old.Log.Path, &c.Log.Path},
+		{"log.file_num", &old.Log.FileNum, &c.Log.FileNum},
+		{"log.file_size", &old.Log.FileSize, &c.Log.FileSize},
+	}
+	var changed []string
+	for _, s := range static {
+		if reflect.DeepEqual(s.old, s.new) {
+			continue
+		}
+		changed = append(changed, s.name)
+		reflect.ValueOf(s.new).Elem().Set(reflect.ValueOf(s.old).Elem())
+	}
+	c.EtcdConfig = old.EtcdConfig
+	return changed
+}
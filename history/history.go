@@ -0,0 +1,366 @@
+// Package history keep the status transitions on the local boltdb.
+package history
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/lodastack/log"
+)
+
+var (
+	bucketName = []byte("history")
+	// timeBucketName index the records by time, key is the time(unix nanosecond) + ID,
+	// the records arrive out of time order such as the retried events.
+	timeBucketName = []byte("history_time")
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+
+	pruneInterval = time.Hour
+	// compactThreshold is the number of pruned records to rewrite the db file,
+	// boltdb does not shrink the file after the records removed.
+	compactThreshold = 1000
+)
+
+// The notify outcome of the transition.
+const (
+	NotifySent        = "sent"
+	NotifyFailed      = "failed"
+	NotifySilenced    = "silenced"
+	NotifyOutOfWindow = "outofwindow"
+	NotifyFlapping    = "flapping"
+	NotifyAcked       = "acked"
+	NotifyBlocked     = "blocked"
+)
+
+// Record is a transition of the status level.
+type Record struct {
+	ID           uint64            `json:"id"`
+	Time         time.Time         `json:"time"`
+	Ns           string            `json:"ns"`
+	AlarmVersion string            `json:"alarmversion"`
+	AlarmName    string            `json:"alarmname"`
+	Host         string            `json:"host"`
+	Tags         map[string]string `json:"tags"`
+	OldLevel     string            `json:"oldlevel"`
+	NewLevel     string            `json:"newlevel"`
+	Value        float64           `json:"value"`
+	Duration     time.Duration     `json:"duration"` // duration of the old level, unit: nanosecond
+	Receivers    []string          `json:"receivers"`
+	Notify       string            `json:"notify"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// Query is the filter of records.
+type Query struct {
+	// Ns match the records of ns and its child ns.
+	Ns           string
+	AlarmVersion string
+	Host         string
+	// Tags match the records having all the tags.
+	Tags  map[string]string
+	Level string
+	Start time.Time
+	End   time.Time
+
+	Offset int
+	Limit  int
+}
+
+func (q *Query) match(r Record) bool {
+	if q.Ns != "" && !strings.HasSuffix("."+r.Ns, "."+q.Ns) {
+		return false
+	}
+	if (q.AlarmVersion != "" && q.AlarmVersion != r.AlarmVersion) ||
+		(q.Host != "" && q.Host != r.Host) ||
+		(q.Level != "" && q.Level != r.NewLevel) {
+		return false
+	}
+	if (!q.Start.IsZero() && r.Time.Before(q.Start)) || (!q.End.IsZero() && r.Time.After(q.End)) {
+		return false
+	}
+	for k, v := range q.Tags {
+		if r.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Page is the records of a query, newest first.
+type Page struct {
+	Total   int      `json:"total"`
+	Offset  int      `json:"offset"`
+	Limit   int      `json:"limit"`
+	Records []Record `json:"records"`
+}
+
+// Store is the history store on boltdb.
+type Store struct {
+	path string
+
+	// mu guard db which is reopened after compaction.
+	mu sync.RWMutex
+	db *bolt.DB
+}
+
+// Open open or create the history store at path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{path: path, db: db}, nil
+}
+
+func openDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		if tx.Bucket(timeBucketName) != nil {
+			return nil
+		}
+		// index the records kept before the time index.
+		index, err := tx.CreateBucket(timeBucketName)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				log.Errorf("unmarshal history %d fail: %s", btoi(k), err.Error())
+				return nil
+			}
+			return index.Put(timeKey(r.Time, r.ID), nil)
+		})
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close close the history db.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Close()
+}
+
+// Add append the record to the store, the ID of record is assigned by the store.
+func (s *Store) Add(r Record) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		r.ID = id
+		v, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(itob(id), v); err != nil {
+			return err
+		}
+		return tx.Bucket(timeBucketName).Put(timeKey(r.Time, id), nil)
+	})
+}
+
+// Query return the page of records matched, newest first.
+func (s *Store) Query(q Query) (Page, error) {
+	if q.Limit < 1 {
+		q.Limit = defaultLimit
+	}
+	if q.Limit > maxLimit {
+		q.Limit = maxLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	page := Page{Offset: q.Offset, Limit: q.Limit, Records: make([]Record, 0)}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		c := tx.Bucket(timeBucketName).Cursor()
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			// the time index is in time order.
+			t, id := parseTimeKey(k)
+			if !q.Start.IsZero() && t.Before(q.Start) {
+				break
+			}
+			if !q.End.IsZero() && t.After(q.End) {
+				continue
+			}
+			v := b.Get(itob(id))
+			if v == nil {
+				continue
+			}
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				log.Errorf("unmarshal history %d fail: %s", id, err.Error())
+				continue
+			}
+			if !q.match(r) {
+				continue
+			}
+			if page.Total >= q.Offset && len(page.Records) < q.Limit {
+				page.Records = append(page.Records, r)
+			}
+			page.Total++
+		}
+		return nil
+	})
+	return page, err
+}
+
+// Prune remove the records older than before, and keep at most max records if max > 0.
+// Return the number of records removed.
+func (s *Store) Prune(before time.Time, max int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var removed int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, index := tx.Bucket(bucketName), tx.Bucket(timeBucketName)
+		over := 0
+		if max > 0 {
+			over = index.Stats().KeyN - max
+		}
+		// remove the oldest records by the time index.
+		c := index.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.First() {
+			t, id := parseTimeKey(k)
+			if !t.Before(before) && removed >= over {
+				break
+			}
+			if err := b.Delete(itob(id)); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// Compact rewrite the db file to release the space of removed records.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmpPath := s.path + ".compact"
+	os.Remove(tmpPath)
+	tmp, err := openDB(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		src := tx.Bucket(bucketName)
+		return tmp.Update(func(tmpTx *bolt.Tx) error {
+			dst := tmpTx.Bucket(bucketName)
+			// keep the sequence, so the record ID is not reused.
+			if err := dst.SetSequence(src.Sequence()); err != nil {
+				return err
+			}
+			if err := src.ForEach(func(k, v []byte) error {
+				return dst.Put(k, v)
+			}); err != nil {
+				return err
+			}
+			dstIndex, err := tmpTx.CreateBucketIfNotExists(timeBucketName)
+			if err != nil {
+				return err
+			}
+			return tx.Bucket(timeBucketName).ForEach(func(k, v []byte) error {
+				return dstIndex.Put(k, v)
+			})
+		})
+	})
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		log.Errorf("replace history db by the compacted fail: %s", err.Error())
+	}
+	s.db, err = openDB(s.path)
+	return err
+}
+
+// RetentionLoop prune the records out of retention or max records periodically,
+// and compact the db file after many records pruned, until ctx is done.
+func (s *Store) RetentionLoop(ctx context.Context, retention time.Duration, max int) {
+	pruned := 0
+	for {
+		removed, err := s.Prune(time.Now().Add(-retention), max)
+		if err != nil {
+			log.Errorf("prune history fail: %s", err.Error())
+		} else if removed > 0 {
+			log.Infof("prune %d history records", removed)
+		}
+		if pruned += removed; pruned >= compactThreshold {
+			if err := s.Compact(); err != nil {
+				log.Errorf("compact history fail: %s", err.Error())
+			} else {
+				pruned = 0
+			}
+		}
+		select {
+		case <-time.After(pruneInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// timeKey return the key of time index, ordered by time then ID.
+func timeKey(t time.Time, id uint64) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(b[8:], id)
+	return b
+}
+
+func parseTimeKey(k []byte) (time.Time, uint64) {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k[:8]))), binary.BigEndian.Uint64(k[8:])
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func btoi(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
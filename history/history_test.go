@@ -0,0 +1,118 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatalf("make temp dir: %s", err)
+	}
+	s, err := Open(filepath.Join(dir, "history.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("open: %s", err)
+	}
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func hosts(records []Record) []string {
+	output := make([]string, len(records))
+	for i, r := range records {
+		output[i] = r.Host
+	}
+	return output
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// addOutOfOrder add the records of host h0..h4 at now-0h..now-4h, not in time order.
+func addOutOfOrder(t *testing.T, s *Store, now time.Time) {
+	for _, i := range []int{2, 0, 4, 1, 3} {
+		r := Record{Time: now.Add(-time.Duration(i) * time.Hour), Ns: "a.loda", Host: "h" + strconv.Itoa(i)}
+		if err := s.Add(r); err != nil {
+			t.Fatalf("add: %s", err)
+		}
+	}
+}
+
+func TestQueryInTimeOrder(t *testing.T) {
+	s, closeFn := openTestStore(t)
+	defer closeFn()
+	now := time.Now()
+	addOutOfOrder(t, s, now)
+
+	page, err := s.Query(Query{})
+	if err != nil {
+		t.Fatalf("query: %s", err)
+	}
+	if expect := []string{"h0", "h1", "h2", "h3", "h4"}; page.Total != 5 || !equal(hosts(page.Records), expect) {
+		t.Fatalf("expect %v, got %d %v", expect, page.Total, hosts(page.Records))
+	}
+
+	// the records out of the time range are skipped even if added later.
+	page, err = s.Query(Query{Start: now.Add(-150 * time.Minute), End: now.Add(-30 * time.Minute), Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("query: %s", err)
+	}
+	if page.Total != 2 || !equal(hosts(page.Records), []string{"h2"}) {
+		t.Fatalf("expect h2 of 2, got %d %v", page.Total, hosts(page.Records))
+	}
+	if page, _ = s.Query(Query{Ns: "loda", Host: "h3"}); page.Total != 1 {
+		t.Fatalf("expect 1 record of h3, got %d", page.Total)
+	}
+}
+
+func TestPruneOldest(t *testing.T) {
+	s, closeFn := openTestStore(t)
+	defer closeFn()
+	now := time.Now()
+	addOutOfOrder(t, s, now)
+
+	// remove the records older than 150 minutes, h4 and h3 though h4 is not the first added.
+	removed, err := s.Prune(now.Add(-150*time.Minute), 0)
+	if err != nil || removed != 2 {
+		t.Fatalf("prune by time: %d %v", removed, err)
+	}
+	// keep the newest 2 records.
+	if removed, err = s.Prune(now.Add(-150*time.Minute), 2); err != nil || removed != 1 {
+		t.Fatalf("prune by max: %d %v", removed, err)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatalf("compact: %s", err)
+	}
+	page, err := s.Query(Query{})
+	if err != nil {
+		t.Fatalf("query: %s", err)
+	}
+	if expect := []string{"h0", "h1"}; !equal(hosts(page.Records), expect) {
+		t.Fatalf("expect %v, got %v", expect, hosts(page.Records))
+	}
+
+	// the record ID is not reused after compaction.
+	if err := s.Add(Record{Time: now, Host: "new"}); err != nil {
+		t.Fatalf("add: %s", err)
+	}
+	if page, _ = s.Query(Query{Host: "new"}); page.Total != 1 || page.Records[0].ID != 6 {
+		t.Fatalf("expect the new record ID 6, got %+v", page.Records)
+	}
+}
@@ -1,6 +1,7 @@
 package loda
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -9,7 +10,6 @@ import (
 
 	"github.com/lodastack/event/common"
 	"github.com/lodastack/event/config"
-	"github.com/lodastack/event/requests"
 	"github.com/lodastack/log"
 	"github.com/lodastack/models"
 )
@@ -28,13 +28,17 @@ var (
 	Alarms lodaAlarm
 )
 
-// UpdateAlarmsFromLoda read alarm resource from registry and update to global.
-func UpdateAlarmsFromLoda() {
+// UpdateAlarmsFromLoda read alarm resource from registry and update to global until ctx is done.
+func UpdateAlarmsFromLoda(ctx context.Context) {
 	for {
 		if err := Alarms.updateAlarms(); err != nil {
 			log.Errorf("loda ReadLoop fail: %s", err.Error())
 		}
-		time.Sleep(updateAlarmsInterval * time.Minute)
+		select {
+		case <-time.After(updateAlarmsInterval * time.Minute):
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
@@ -68,6 +72,9 @@ func newAlarm(alarm models.Alarm) *Alarm {
 type lodaAlarm struct {
 	sync.RWMutex
 	NsAlarms map[string]map[string]*Alarm
+
+	// updated is the time of the last successful refresh.
+	updated time.Time
 }
 
 func (l *lodaAlarm) updateAlarms() error {
@@ -116,9 +123,24 @@ func (l *lodaAlarm) updateAlarms() error {
 		}
 
 	}
+	l.updated = time.Now()
 	return nil
 }
 
+// AlarmsLoaded return the initial load of alarms from registry is finished or not.
+func AlarmsLoaded() bool {
+	Alarms.RLock()
+	defer Alarms.RUnlock()
+	return len(Alarms.NsAlarms) != 0
+}
+
+// AlarmsUpdated return the time of the last successful refresh of alarms, zero if never.
+func AlarmsUpdated() time.Time {
+	Alarms.RLock()
+	defer Alarms.RUnlock()
+	return Alarms.updated
+}
+
 // RespAlarm is response from registry to get alarm resource.
 type respAlarm struct {
 	HTTPStatus int            `json:"httpstatus"`
@@ -137,7 +159,7 @@ func getAlarmsByNs(ns string) (map[string]models.Alarm, error) {
 	respAlarms := respAlarm{}
 
 	url := fmt.Sprintf("%s"+alarmURI, config.GetConfig().Reg.Link, ns)
-	resp, err := requests.Get(url)
+	resp, err := registryGet("alarm", url)
 	if err != nil {
 		log.Errorf("get alarm of ns %s error: %s", ns, err.Error())
 		return nil, err
@@ -150,3 +172,15 @@ func getAlarmsByNs(ns string) (map[string]models.Alarm, error) {
 	err = json.Unmarshal(resp.Body, &respAlarms)
 	return getAlarmsMap(respAlarms.Data), err
 }
+
+// AlarmVersionByName return the version of the ns alarm which name is the input name.
+func AlarmVersionByName(ns, name string) (string, bool) {
+	Alarms.RLock()
+	defer Alarms.RUnlock()
+	for version, alarm := range Alarms.NsAlarms[ns] {
+		if alarm.AlarmData.Name == name {
+			return version, true
+		}
+	}
+	return "", false
+}
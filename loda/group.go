@@ -3,22 +3,33 @@ package loda
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/lodastack/event/common"
 	"github.com/lodastack/event/config"
-	"github.com/lodastack/event/requests"
 
 	"github.com/lodastack/log"
 )
 
 var (
 	lodaDefault = "loda-defaultuser"
+
+	// OnCallResolver return the on-call users of the group at time t,
+	// ok is false if the group has no on-call schedule.
+	OnCallResolver func(gname string, t time.Time) (users []string, ok bool)
 )
 
 // GetGroupUsers return users of the groups.
+// Return the on-call users if the group point at a schedule.
 func GetGroupUsers(groups []string) []string {
 	recievers := make([]string, 0)
 	for _, gname := range groups {
+		if OnCallResolver != nil {
+			if users, ok := OnCallResolver(gname, time.Now()); ok {
+				recievers = append(recievers, users...)
+				continue
+			}
+		}
 		users, err := getUserOfGroup(gname)
 		if err != nil {
 			continue
@@ -46,28 +57,37 @@ type responseGroup struct {
 	Data       Group `json:"data"`
 }
 
-// getUserByGroup return the user list of the groupname by query regsitry.
-func getUserOfGroup(gname string) ([]string, error) {
+// getGroup return the group by query regsitry.
+func getGroup(gname string) (Group, error) {
 	var respGroup responseGroup
-	var users []string
 	url := fmt.Sprintf("%s/api/v1/event/group?gname=%s", config.GetConfig().Reg.Link, gname)
 
-	resp, err := requests.Get(url)
+	resp, err := registryGet("group", url)
 	if err != nil {
 		log.Errorf("get group error: %s", err.Error())
-		return users, err
+		return respGroup.Data, err
 	}
 
 	if resp.Status != 200 {
-		return users, fmt.Errorf("http status code: %d", resp.Status)
+		return respGroup.Data, fmt.Errorf("http status code: %d", resp.Status)
 	}
 	err = json.Unmarshal(resp.Body, &respGroup)
 	if err != nil {
 		log.Errorf("get group error: %s", err.Error())
+		return respGroup.Data, err
+	}
+	return respGroup.Data, nil
+}
+
+// getUserByGroup return the user list of the groupname by query regsitry.
+func getUserOfGroup(gname string) ([]string, error) {
+	var users []string
+	group, err := getGroup(gname)
+	if err != nil {
 		return users, err
 	}
-	users = append(users, respGroup.Data.Managers...)
-	users = append(users, respGroup.Data.Members...)
+	users = append(users, group.Managers...)
+	users = append(users, group.Members...)
 	users = common.RemoveDuplicateAndEmpty(users)
 
 	if i, ok := common.ContainString(users, lodaDefault); ok {
@@ -76,3 +96,33 @@ func getUserOfGroup(gname string) ([]string, error) {
 
 	return users[:], nil
 }
+
+// GetGroupUsersByRole return managers or members of the groups,
+// return all users of the groups if role is empty, or the on-call users if the group point at a schedule.
+// The schedule is skipped if role is set, so the escalation reaches other than the paged on-call user.
+func GetGroupUsersByRole(groups []string, role string) []string {
+	if role == "" {
+		return GetGroupUsers(groups)
+	}
+	recievers := make([]string, 0)
+	for _, gname := range groups {
+		group, err := getGroup(gname)
+		if err != nil {
+			continue
+		}
+		switch role {
+		case "managers":
+			recievers = append(recievers, group.Managers...)
+		case "members":
+			recievers = append(recievers, group.Members...)
+		}
+	}
+	recievers = common.RemoveDuplicateAndEmpty(recievers)
+	if i, ok := common.ContainString(recievers, lodaDefault); ok {
+		recievers = append(recievers[:i], recievers[i+1:]...)
+	}
+	if len(recievers) == 0 {
+		return nil
+	}
+	return recievers
+}
@@ -1,13 +1,13 @@
 package loda
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/lodastack/event/config"
-	"github.com/lodastack/event/requests"
 
 	"github.com/lodastack/log"
 )
@@ -36,10 +36,12 @@ var (
 	// Machines save all machine resource, hostname is the key of map.
 	Machines  map[string]map[string]string
 	machineMu sync.RWMutex
+	// machinesUpdated is the time of the last successful refresh of Machines.
+	machinesUpdated time.Time
 )
 
-// UpdateOffMachineLoop update all offline machine to offlineMachines.
-func UpdateOffMachineLoop() {
+// UpdateOffMachineLoop update all offline machine to offlineMachines until ctx is done.
+func UpdateOffMachineLoop(ctx context.Context) {
 	var err error
 	machineMu.Lock()
 	offlineMachines, err = getOfflineMachines()
@@ -54,7 +56,7 @@ func UpdateOffMachineLoop() {
 			log.Errorf("get offline machine err: %s", err.Error())
 		} else {
 			machineMu.Lock()
-			Machines = machines
+			Machines, machinesUpdated = machines, time.Now()
 			machineMu.Unlock()
 		}
 
@@ -70,16 +72,26 @@ func UpdateOffMachineLoop() {
 
 	getMachines()
 	go func() {
-		c := time.Tick(offlineMachineInterval * time.Second)
+		ticker := time.NewTicker(offlineMachineInterval * time.Second)
+		defer ticker.Stop()
 		for {
 			select {
-			case <-c:
+			case <-ticker.C:
 				getMachines()
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 }
 
+// MachinesUpdated return the time of the last successful refresh of machines, zero if never.
+func MachinesUpdated() time.Time {
+	machineMu.RLock()
+	defer machineMu.RUnlock()
+	return machinesUpdated
+}
+
 // allMachine return all ns and its machine resource from registry.
 func allMachine() (map[string]map[string]string, error) {
 	allNs, err := allNS()
@@ -101,7 +113,7 @@ func oneNsMachine(ns string) (map[string]string, error) {
 	var machineIps map[string]string
 	url := fmt.Sprintf("%s"+getMachineURI, config.GetConfig().Reg.Link, ns)
 
-	resp, err := requests.Get(url)
+	resp, err := registryGet("machine", url)
 	if err != nil {
 		log.Errorf("get all ns error: %s", err.Error())
 		return machineIps, err
@@ -135,7 +147,7 @@ func getOfflineMachines() (map[string]map[string]bool, error) {
 	url := fmt.Sprintf("%s/api/v1/event/resource/search?ns=%s&type=%s&k=%s&v=%s",
 		config.GetConfig().Reg.Link, "loda", "machine", "status", "offline")
 
-	resp, err := requests.Get(url)
+	resp, err := registryGet("machine", url)
 	if err != nil {
 		log.Errorf("get all ns error: %s", err.Error())
 		return offlineMachine, err
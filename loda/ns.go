@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/lodastack/event/config"
-	"github.com/lodastack/event/requests"
 
 	"github.com/lodastack/log"
 )
@@ -22,7 +21,7 @@ func allNS() ([]string, error) {
 	var res []string
 	url := fmt.Sprintf("%s/api/v1/event/ns?ns=&format=list", config.GetConfig().Reg.Link)
 
-	resp, err := requests.Get(url)
+	resp, err := registryGet("ns", url)
 	if err != nil {
 		log.Errorf("get all ns error: %s", err.Error())
 		return res, err
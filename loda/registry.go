@@ -0,0 +1,18 @@
+package loda
+
+import (
+	"time"
+
+	"github.com/lodastack/event/metrics"
+	"github.com/lodastack/event/requests"
+)
+
+// registryGet get the resource from registry, and observe the latency and failure of the fetch.
+func registryGet(resource, url string) (*requests.Resp, error) {
+	defer metrics.RegistryFetchDuration.Since(time.Now(), resource)
+	resp, err := requests.Get(url)
+	if err != nil || resp.Status != 200 {
+		metrics.RegistryFetchErrors.Inc(resource)
+	}
+	return resp, err
+}
@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/lodastack/event/config"
-	"github.com/lodastack/event/requests"
 
 	"github.com/lodastack/log"
 )
@@ -115,6 +114,8 @@ type User struct {
 	Username string `json:"username"`
 	Mobile   string `json:"mobile"`
 	Alert    string `json:"alert,omitempty"`
+	// Locale is the language of the notify to user, such as en-US or zh-CN.
+	Locale string `json:"locale,omitempty"`
 }
 
 // RespUser is response from regsitry to query user.
@@ -127,7 +128,7 @@ func getUsersFromServer(usernames []string) (map[string]User, error) {
 	var respUser respUser
 	url := fmt.Sprintf("%s/api/v1/event/user/list?usernames=%s", config.GetConfig().Reg.Link, strings.Join(usernames, ","))
 
-	resp, err := requests.Get(url)
+	resp, err := registryGet("user", url)
 	if err != nil {
 		log.Errorf("get group error: %s", err.Error())
 		return nil, err
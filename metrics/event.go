@@ -0,0 +1,45 @@
+package metrics
+
+// The metrics of event service.
+var (
+	// EventsReceived count the events received, label endpoint: post or alertmanager.
+	EventsReceived = NewCounter("event_events_received_total",
+		"Number of events received by endpoint and level.", "endpoint", "level")
+
+	// HandleEventDuration observe the latency of HandleEvent, label result: success or failure.
+	HandleEventDuration = NewHistogram("event_handle_event_duration_seconds",
+		"Latency of handling an event.", nil, "result")
+
+	// BlockDecisions count the block decisions, label decision: blocked or sent.
+	BlockDecisions = NewCounter("event_block_decisions_total",
+		"Number of block decisions of the alert events.", "decision")
+
+	// Notifications count the notifications per channel, label result: success or failure.
+	Notifications = NewCounter("event_notifications_total",
+		"Number of notifications by channel and result.", "channel", "result")
+
+	// OutputDuration observe the latency of output, label output: sms_script, wechat_script or smtp.
+	OutputDuration = NewHistogram("event_output_duration_seconds",
+		"Latency of running the output script or sending mail by SMTP.", nil, "output")
+
+	// RegistryFetchDuration observe the latency to fetch resources from registry,
+	// label resource: ns, alarm, machine, group or user.
+	RegistryFetchDuration = NewHistogram("event_registry_fetch_duration_seconds",
+		"Latency of fetching resources from registry.", nil, "resource")
+
+	// RegistryFetchErrors count the failed fetches from registry.
+	RegistryFetchErrors = NewCounter("event_registry_fetch_errors_total",
+		"Number of failed fetches from registry by resource.", "resource")
+
+	// EtcdDuration observe the latency of etcd operations, label op is the cluster method.
+	EtcdDuration = NewHistogram("event_etcd_operation_duration_seconds",
+		"Latency of etcd operations.", nil, "op")
+)
+
+// Result return the result label value of err.
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
@@ -0,0 +1,234 @@
+// Package metrics collect the counters and histograms of event,
+// and expose them in the prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets is the default buckets of histogram, unit: second.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// labelSep join the label values as the key of series.
+const labelSep = "\xff"
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// WriteTo write all metrics in the prometheus text format.
+func WriteTo(w io.Writer) error {
+	registryMu.Lock()
+	collectors := make([]collector, len(registry))
+	copy(collectors, registry)
+	registryMu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Counter is a counter with labels.
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter create and register the counter.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Inc increase the counter of the label values by 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increase the counter of the label values by v.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, labelSep)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		writeSample(w, c.name, c.labels, strings.Split(key, labelSep), "", "", c.values[key])
+	}
+}
+
+// Histogram is a histogram with labels.
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram create and register the histogram, DefBuckets is used if buckets is empty.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramValue)}
+	register(h)
+	return h
+}
+
+// Observe add the value to the histogram of the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, labelSep)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+// Since observe the seconds elapsed since start.
+func (h *Histogram) Since(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hv, labelValues := h.values[key], strings.Split(key, labelSep)
+		for i, upper := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.labels, labelValues, "le", formatFloat(upper), float64(hv.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, labelValues, "le", "+Inf", float64(hv.count))
+		writeSample(w, h.name+"_sum", h.labels, labelValues, "", "", hv.sum)
+		writeSample(w, h.name+"_count", h.labels, labelValues, "", "", float64(hv.count))
+	}
+}
+
+// GaugeFunc is a gauge with one label, the values are read by the function when exposed.
+type GaugeFunc struct {
+	name  string
+	help  string
+	label string
+	fn    func() map[string]float64
+}
+
+// NewGaugeFunc create and register the gauge, fn return the value of every label value.
+func NewGaugeFunc(name, help, label string, fn func() map[string]float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, label: label, fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	values := g.fn()
+	for _, key := range sortedKeys(values) {
+		writeSample(w, g.name, []string{g.label}, []string{key}, "", "", values[key])
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// writeSample write a sample line, the extra label is appended if not empty.
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	pairs := make([]string, 0, len(labels)+1)
+	for i, label := range labels {
+		var value string
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+		pairs = append(pairs, label+`="`+labelEscaper.Replace(value)+`"`)
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, extraLabel+`="`+extraValue+`"`)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
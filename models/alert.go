@@ -6,6 +6,8 @@ package models
 */
 
 import (
+	"time"
+
 	"github.com/influxdata/kapacitor/services/alert"
 )
 
@@ -18,6 +20,9 @@ type EventData struct {
 	alert.AlertData
 
 	Ns string `json:"-"` // Ns id added by event, used to genarete notify message.
+
+	// Since is the createtime of the status, used to genarete the duration in notify message.
+	Since time.Time `json:"-"`
 }
 
 // Host return the hostname in first series tags.
@@ -0,0 +1,148 @@
+package models
+
+/*
+	Prometheus Alertmanager sent webhook request which body contain groups of firing/resolved alerts.
+	Event map each alert to the ns/alarm/host/tags identity and handle it as a kapacitor alert.
+*/
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	influxModels "github.com/influxdata/influxdb/models"
+	"github.com/influxdata/kapacitor/alert"
+)
+
+const (
+	// AlertmanagerResolved is the status of resolved alert.
+	AlertmanagerResolved = "resolved"
+
+	// labels used to read the identity of alertmanager alert.
+	NsLabel          = "ns"
+	VersionLabel     = "version"
+	AlertNameLabel   = "alertname"
+	SeverityLabel    = "severity"
+	InstanceLabel    = "instance"
+	MeasurementLabel = "measurement"
+
+	// ValueAnnotation is the annotation keep the alert value.
+	ValueAnnotation = "value"
+)
+
+// identityLabels are not treated as tag of the alert.
+var identityLabels = map[string]bool{
+	NsLabel:        true,
+	VersionLabel:   true,
+	AlertNameLabel: true,
+	SeverityLabel:  true,
+}
+
+// AlertmanagerMsg is the body of alertmanager webhook request.
+type AlertmanagerMsg struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []AlertmanagerAlert `json:"alerts"`
+}
+
+// AlertmanagerAlert is one alert of alertmanager webhook request.
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Ns return the ns of the alert.
+func (a *AlertmanagerAlert) Ns() string {
+	return a.Labels[NsLabel]
+}
+
+// Version return the alarm version of the alert, maybe empty.
+func (a *AlertmanagerAlert) Version() string {
+	return a.Labels[VersionLabel]
+}
+
+// Name return the alertname of the alert.
+func (a *AlertmanagerAlert) Name() string {
+	return a.Labels[AlertNameLabel]
+}
+
+// Host return the host label of the alert,
+// or the instance label without port if has no host label.
+func (a *AlertmanagerAlert) Host() string {
+	if host, ok := a.Labels[HostTagName]; ok {
+		return host
+	}
+	instance := a.Labels[InstanceLabel]
+	if host, _, err := net.SplitHostPort(instance); err == nil {
+		return host
+	}
+	return instance
+}
+
+// Level return the kapacitor level of the alert by status and severity label.
+func (a *AlertmanagerAlert) Level() alert.Level {
+	if a.Status == AlertmanagerResolved {
+		return alert.OK
+	}
+	switch a.Labels[SeverityLabel] {
+	case "warning", "warn":
+		return alert.Warning
+	case "info":
+		return alert.Info
+	default:
+		return alert.Critical
+	}
+}
+
+// EventData convert the alert to EventData as kapacitor alert.
+func (a *AlertmanagerAlert) EventData() EventData {
+	tags := make(map[string]string, len(a.Labels))
+	for k, v := range a.Labels {
+		if identityLabels[k] {
+			continue
+		}
+		tags[k] = v
+	}
+	if host := a.Host(); host != "" {
+		tags[HostTagName] = host
+	}
+
+	measurement := a.Labels[MeasurementLabel]
+	if measurement == "" {
+		measurement = a.Name()
+	}
+	value, _ := strconv.ParseFloat(a.Annotations[ValueAnnotation], 64)
+
+	t := a.StartsAt
+	if a.Status == AlertmanagerResolved && !a.EndsAt.IsZero() {
+		t = a.EndsAt
+	}
+
+	var eventData EventData
+	eventData.ID = a.Fingerprint
+	eventData.Message = a.Annotations["summary"]
+	eventData.Details = a.Annotations["description"]
+	eventData.Time = t
+	eventData.Level = a.Level()
+	eventData.Data = influxql.Result{
+		Series: influxModels.Rows{&influxModels.Row{
+			Name:    measurement,
+			Tags:    tags,
+			Columns: []string{"time", "value"},
+			Values:  [][]interface{}{{t, value}},
+		}},
+	}
+	return eventData
+}
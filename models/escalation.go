@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// RoleManagers notify the managers of the groups.
+	RoleManagers = "managers"
+	// RoleMembers notify the members of the groups.
+	RoleMembers = "members"
+)
+
+// EscalationStep notify the groups if the status is not acked After minutes since it is created.
+type EscalationStep struct {
+	After int `json:"after"` // unit: minute
+	// Groups to notify, use the alarm groups if empty.
+	Groups []string `json:"groups"`
+	// Role is managers or members of the groups, notify all of them if empty.
+	Role string `json:"role"`
+	// Alert is the alert types, use the alarm alert types if empty.
+	Alert []string `json:"alert"`
+}
+
+// EscalationPolicy is the escalation chain of the ns or alarm.
+type EscalationPolicy struct {
+	Name string `json:"name"`
+
+	Ns string `json:"ns"`
+	// NsSubtree make the policy work on the ns and its child ns.
+	NsSubtree bool `json:"nssubtree"`
+	// Alarm is the alarm version or name, the policy work on all alarms of ns if empty.
+	Alarm string `json:"alarm"`
+
+	Steps []EscalationStep `json:"steps"`
+}
+
+// Validate check the policy is valid or not, and sort the steps by After.
+func (p *EscalationPolicy) Validate() error {
+	if p.Name == "" || strings.ContainsAny(p.Name, "/ ") {
+		return errors.New("invalid escalation name")
+	}
+	if p.Ns == "" {
+		return errors.New("escalation has no ns")
+	}
+	if len(p.Steps) == 0 {
+		return errors.New("escalation has no step")
+	}
+	for _, step := range p.Steps {
+		if step.After < 1 {
+			return errors.New("escalation step should be after 1 minute at least")
+		}
+		if step.Role != "" && step.Role != RoleManagers && step.Role != RoleMembers {
+			return errors.New("invalid escalation step role: " + step.Role)
+		}
+	}
+	sort.SliceStable(p.Steps, func(i, j int) bool { return p.Steps[i].After < p.Steps[j].After })
+	return nil
+}
+
+// Match return the policy work on the ns/alarm or not.
+func (p *EscalationPolicy) Match(ns, alarmVersion, alarmName string) bool {
+	if p.NsSubtree {
+		if !strings.HasSuffix("."+ns, "."+p.Ns) {
+			return false
+		}
+	} else if p.Ns != ns {
+		return false
+	}
+	return p.Alarm == "" || p.Alarm == alarmVersion || p.Alarm == alarmName
+}
+
+// DueStep return the index of the last step should be notified
+// since the status is created for elapsed, return -1 if no step is due.
+func (p *EscalationPolicy) DueStep(elapsed time.Duration) int {
+	due := -1
+	for i, step := range p.Steps {
+		if elapsed >= time.Duration(step.After)*time.Minute {
+			due = i
+		}
+	}
+	return due
+}
+
+// EscalationState is the last escalated step of a status.
+type EscalationState struct {
+	// Since is the createtime of the status escalated.
+	Since int64 `json:"since"` // unix second
+	Step  int   `json:"step"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// FlapState is the recent level transitions of a status.
+type FlapState struct {
+	// Level is the last level recorded.
+	Level string `json:"level"`
+	// Transitions is the time of the level transitions in the window.
+	Transitions []int64 `json:"transitions"` // unix second
+	Flapping    bool    `json:"flapping"`
+}
+
+// Record the level at time t, drop the transitions out of the window.
+// The state starts flapping if the transitions reach threshold,
+// and stops flapping if the transitions fall below recover.
+// Return changed is true if the state need to be saved.
+func (s *FlapState) Record(level string, t time.Time, window time.Duration, threshold, recover int) (changed bool) {
+	if s.Level != level {
+		if s.Level != "" {
+			s.Transitions = append(s.Transitions, t.Unix())
+		}
+		changed = true
+	}
+	s.Level = level
+
+	since := t.Add(-window).Unix()
+	var i int
+	for i < len(s.Transitions) && s.Transitions[i] <= since {
+		i++
+	}
+	if i > 0 {
+		s.Transitions = s.Transitions[i:]
+		changed = true
+	}
+
+	switch {
+	case !s.Flapping && len(s.Transitions) >= threshold:
+		s.Flapping, changed = true, true
+	case s.Flapping && len(s.Transitions) < recover:
+		s.Flapping, changed = false, true
+	}
+	return changed
+}
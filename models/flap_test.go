@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlapState(t *testing.T) {
+	var s FlapState
+	now := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	window := 10 * time.Minute
+	record := func(level string, offset time.Duration) bool {
+		return s.Record(level, now.Add(offset), window, 3, 1)
+	}
+
+	if !record("OK", 0) || len(s.Transitions) != 0 {
+		t.Fatalf("the first level is not a transition: %+v", s)
+	}
+	if record("OK", time.Minute) {
+		t.Fatalf("the same level is not changed: %+v", s)
+	}
+	record("CRITICAL", 2*time.Minute)
+	record("OK", 3*time.Minute)
+	if s.Flapping {
+		t.Fatalf("flapping below threshold: %+v", s)
+	}
+	if !record("CRITICAL", 4*time.Minute) || !s.Flapping || len(s.Transitions) != 3 {
+		t.Fatalf("expect flapping at threshold: %+v", s)
+	}
+
+	// the transitions out of window are dropped, keep flapping above recover.
+	record("CRITICAL", 12*time.Minute+30*time.Second)
+	if !s.Flapping || len(s.Transitions) != 2 {
+		t.Fatalf("expect flapping with 2 transitions: %+v", s)
+	}
+	if !record("CRITICAL", 14*time.Minute+30*time.Second) || s.Flapping || len(s.Transitions) != 0 {
+		t.Fatalf("expect recovered: %+v", s)
+	}
+}
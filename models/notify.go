@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
 // NotifyData is the notify infomation.
 // It will generate different noitify content by different notify type.
@@ -19,6 +24,38 @@ type NotifyData struct {
 	Expression  string
 
 	Msg string
+
+	// Message is the alarm message template to render the notify content, maybe empty.
+	Message string
+	// Duration is how long the status lasted since created.
+	Duration time.Duration
+
+	// WebHooks is the url list to post the notify data.
+	WebHooks []string
+
+	// Ack is the acknowledgement of the status, maybe nil.
+	Ack *Ack
+
+	// Locale is the language of the notify content, such as en-US or zh-CN.
+	Locale string
+
+	// Digest is the converged notify, the notify is a summary if not empty.
+	Digest []NotifyData
+}
+
+// DigestLines return one line per converged notify, like "time host tags level value".
+func (n NotifyData) DigestLines(timeFormat string) []string {
+	lines := make([]string, len(n.Digest))
+	for i, item := range n.Digest {
+		tags := make([]string, 0, len(item.Tags))
+		for k, v := range item.Tags {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		lines[i] = fmt.Sprintf("%s %s %s %s %s %s %.2f",
+			item.Time.Format(timeFormat), item.Ns, item.AlarmName, item.Host, strings.Join(tags, ","), item.Level, item.Value)
+	}
+	return lines
 }
 
 // NewAlertMsg genarate NotifyData by alert infomation.
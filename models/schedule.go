@@ -0,0 +1,225 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	scheduleTimeFormat = "2006-01-02 15:04"
+	clockFormat        = "15:04"
+)
+
+// Schedule is an on-call schedule, the groups of the schedule are resolved to the on-call users.
+// The override is preferred, then the layer with larger index.
+type Schedule struct {
+	Name string `json:"name"`
+	// TimeZone is the IANA time zone name the layer start and restriction is in, use local if empty.
+	TimeZone string `json:"timezone"`
+	// Groups point at the schedule.
+	Groups []string `json:"groups"`
+
+	Layers    []ScheduleLayer    `json:"layers"`
+	Overrides []ScheduleOverride `json:"overrides"`
+}
+
+// ScheduleLayer rotate the users every Rotation hours since the Start handoff time.
+type ScheduleLayer struct {
+	Name  string   `json:"name"`
+	Users []string `json:"users"`
+	// Start is the first handoff time, format: 2006-01-02 15:04.
+	Start    string `json:"start"`
+	Rotation int    `json:"rotation"` // unit: hour
+
+	// From/To restrict the layer to a daily window, format 15:04, the layer works all day if empty.
+	// The window crosses midnight if To is before From.
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ScheduleOverride replace the on-call users by User between Start and End.
+type ScheduleOverride struct {
+	User  string    `json:"user"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Shift is one on-call turn of the schedule.
+type Shift struct {
+	Layer string    `json:"layer"`
+	User  string    `json:"user"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Location return the time zone of the schedule.
+func (s *Schedule) Location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(s.TimeZone)
+}
+
+// Validate check the schedule is valid or not.
+func (s *Schedule) Validate() error {
+	if s.Name == "" || strings.ContainsAny(s.Name, "/ ") {
+		return errors.New("invalid schedule name")
+	}
+	loc, err := s.Location()
+	if err != nil {
+		return fmt.Errorf("invalid schedule timezone: %s", err.Error())
+	}
+	if len(s.Layers) == 0 {
+		return errors.New("schedule has no layer")
+	}
+	for _, layer := range s.Layers {
+		if len(layer.Users) == 0 || layer.Rotation < 1 {
+			return fmt.Errorf("schedule layer %s should have users and rotation", layer.Name)
+		}
+		if _, err := time.ParseInLocation(scheduleTimeFormat, layer.Start, loc); err != nil {
+			return fmt.Errorf("invalid schedule layer %s start: %s", layer.Name, err.Error())
+		}
+		if (layer.From == "") != (layer.To == "") {
+			return fmt.Errorf("schedule layer %s should have both from and to", layer.Name)
+		}
+		if layer.From != "" {
+			if _, err := time.Parse(clockFormat, layer.From); err != nil {
+				return fmt.Errorf("invalid schedule layer %s from: %s", layer.Name, err.Error())
+			}
+			if _, err := time.Parse(clockFormat, layer.To); err != nil {
+				return fmt.Errorf("invalid schedule layer %s to: %s", layer.Name, err.Error())
+			}
+		}
+	}
+	for _, override := range s.Overrides {
+		if override.User == "" || !override.End.After(override.Start) {
+			return errors.New("schedule override should have user and end after start")
+		}
+	}
+	return nil
+}
+
+// OnCall return the on-call users at time t.
+func (s *Schedule) OnCall(t time.Time) []string {
+	users := make([]string, 0)
+	for _, override := range s.Overrides {
+		if !t.Before(override.Start) && t.Before(override.End) {
+			users = append(users, override.User)
+		}
+	}
+	if len(users) != 0 {
+		return users
+	}
+
+	loc, err := s.Location()
+	if err != nil {
+		return users
+	}
+	for i := len(s.Layers) - 1; i >= 0; i-- {
+		if user, ok := s.Layers[i].onCall(t, loc); ok {
+			return append(users, user)
+		}
+	}
+	return users
+}
+
+// Shifts return the shifts of the layers and overrides between from and to.
+func (s *Schedule) Shifts(from, to time.Time) []Shift {
+	shifts := make([]Shift, 0)
+	loc, err := s.Location()
+	if err != nil {
+		return shifts
+	}
+	for _, layer := range s.Layers {
+		shifts = append(shifts, layer.shifts(from, to, loc)...)
+	}
+	for _, override := range s.Overrides {
+		if override.End.After(from) && override.Start.Before(to) {
+			shifts = append(shifts, Shift{Layer: "override", User: override.User, Start: override.Start, End: override.End})
+		}
+	}
+	sort.Slice(shifts, func(i, j int) bool { return shifts[i].Start.Before(shifts[j].Start) })
+	return shifts
+}
+
+// onCall return the on-call user of the layer at time t.
+func (l *ScheduleLayer) onCall(t time.Time, loc *time.Location) (string, bool) {
+	start, err := time.ParseInLocation(scheduleTimeFormat, l.Start, loc)
+	if err != nil || t.Before(start) || len(l.Users) == 0 || l.Rotation < 1 || !l.inWindow(t.In(loc)) {
+		return "", false
+	}
+	turn := turnAt(start, t, l.Rotation)
+	return l.Users[turn%len(l.Users)], true
+}
+
+// shifts return the rotation turns of the layer between from and to.
+// NOTE: the daily window of the layer is not split out of the turn.
+func (l *ScheduleLayer) shifts(from, to time.Time, loc *time.Location) []Shift {
+	shifts := make([]Shift, 0)
+	start, err := time.ParseInLocation(scheduleTimeFormat, l.Start, loc)
+	if err != nil || len(l.Users) == 0 || l.Rotation < 1 {
+		return shifts
+	}
+	turn := 0
+	if from.After(start) {
+		turn = turnAt(start, from, l.Rotation)
+	}
+	for turnStart := handoff(start, l.Rotation, turn); turnStart.Before(to); turn++ {
+		turnEnd := handoff(start, l.Rotation, turn+1)
+		shifts = append(shifts, Shift{Layer: l.Name, User: l.Users[turn%len(l.Users)], Start: turnStart, End: turnEnd})
+		turnStart = turnEnd
+	}
+	return shifts
+}
+
+// handoff return the start time of the nth turn rotated every rotation hours since start.
+// The turns are counted by the wall clock in the location of start, so the handoff keeps its clock across DST.
+func handoff(start time.Time, rotation, n int) time.Time {
+	hours := n * rotation
+	return time.Date(start.Year(), start.Month(), start.Day()+hours/24, start.Hour()+hours%24,
+		start.Minute(), start.Second(), 0, start.Location())
+}
+
+// turnAt return the turn rotated every rotation hours since start at t, t should not be before start.
+func turnAt(start, t time.Time, rotation int) int {
+	t = t.In(start.Location())
+	// count the days between the dates, UTC has no DST.
+	days := int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Sub(
+		time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)).Hours()) / 24
+	minutes := days*24*60 + (t.Hour()-start.Hour())*60 + t.Minute() - start.Minute()
+	turn := minutes / (rotation * 60)
+	// the clock is skipped or repeated on DST transition, correct the turn by the handoff time.
+	for turn > 0 && handoff(start, rotation, turn).After(t) {
+		turn--
+	}
+	for !handoff(start, rotation, turn+1).After(t) {
+		turn++
+	}
+	return turn
+}
+
+// inWindow return t is in the daily window of the layer or not.
+func (l *ScheduleLayer) inWindow(t time.Time) bool {
+	if l.From == "" || l.To == "" {
+		return true
+	}
+	from, err1 := time.Parse(clockFormat, l.From)
+	to, err2 := time.Parse(clockFormat, l.To)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	return InDailyWindow(t, from.Hour()*60+from.Minute(), to.Hour()*60+to.Minute())
+}
+
+// InDailyWindow return the clock of t is in [from, to) or not, unit of from/to: minute of day.
+// The window crosses midnight if to is before from.
+func InDailyWindow(t time.Time, from, to int) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRotationAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("load time zone: %s", err)
+	}
+	// DST starts at 2026-03-08 02:00 in New York, the day is 23 hours.
+	s := Schedule{
+		Name:     "ops",
+		TimeZone: "America/New_York",
+		Layers:   []ScheduleLayer{{Name: "daily", Users: []string{"alice", "bob"}, Start: "2026-03-01 09:00", Rotation: 24}},
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("validate: %s", err)
+	}
+
+	for _, c := range []struct {
+		at   time.Time
+		user string
+	}{
+		{time.Date(2026, 3, 7, 9, 0, 0, 0, loc), "alice"},
+		{time.Date(2026, 3, 8, 8, 59, 0, 0, loc), "alice"},
+		{time.Date(2026, 3, 8, 9, 0, 0, 0, loc), "bob"},
+		{time.Date(2026, 3, 9, 8, 59, 0, 0, loc), "bob"},
+		{time.Date(2026, 3, 9, 9, 0, 0, 0, loc), "alice"},
+	} {
+		if users := s.OnCall(c.at); len(users) != 1 || users[0] != c.user {
+			t.Fatalf("on call at %s: expect %s, got %v", c.at, c.user, users)
+		}
+	}
+
+	shifts := s.Shifts(time.Date(2026, 3, 7, 12, 0, 0, 0, loc), time.Date(2026, 3, 9, 12, 0, 0, 0, loc))
+	if len(shifts) != 3 {
+		t.Fatalf("expect 3 shifts, got %+v", shifts)
+	}
+	for i, shift := range shifts {
+		if start := shift.Start.In(loc); start.Hour() != 9 || start.Minute() != 0 {
+			t.Fatalf("shift %d not handoff at 09:00: %s", i, start)
+		}
+		if i > 0 && !shift.Start.Equal(shifts[i-1].End) {
+			t.Fatalf("shift %d not start at the end of previous: %s %s", i, shift.Start, shifts[i-1].End)
+		}
+	}
+	if d := shifts[0].End.Sub(shifts[0].Start); d != 23*time.Hour {
+		t.Fatalf("expect the shift across DST 23h, got %s", d)
+	}
+}
+
+func TestScheduleOverride(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	s := Schedule{
+		Name:      "ops",
+		TimeZone:  "UTC",
+		Layers:    []ScheduleLayer{{Name: "weekly", Users: []string{"alice", "bob"}, Start: "2026-03-01 09:00", Rotation: 24 * 7}},
+		Overrides: []ScheduleOverride{{User: "carol", Start: start.Add(time.Hour), End: start.Add(2 * time.Hour)}},
+	}
+	if users := s.OnCall(start.Add(90 * time.Minute)); len(users) != 1 || users[0] != "carol" {
+		t.Fatalf("expect override carol, got %v", users)
+	}
+	if users := s.OnCall(start.Add(2 * time.Hour)); len(users) != 1 || users[0] != "alice" {
+		t.Fatalf("expect alice after override, got %v", users)
+	}
+	if users := s.OnCall(start.Add(-time.Minute)); len(users) != 0 {
+		t.Fatalf("expect nobody before start, got %v", users)
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Silence mute the notify of the events matched in its time range.
+// Empty matcher matches everything.
+type Silence struct {
+	ID string `json:"id"`
+
+	Ns string `json:"ns"`
+	// NsSubtree make the silence match the ns and its child ns.
+	NsSubtree bool `json:"nssubtree"`
+	// Alarm is the alarm version or alarm name.
+	Alarm string            `json:"alarm"`
+	Host  string            `json:"host"`
+	Tags  map[string]string `json:"tags"`
+
+	StartTime time.Time `json:"starttime"`
+	EndTime   time.Time `json:"endtime"`
+
+	Creator    string    `json:"creator"`
+	Comment    string    `json:"comment"`
+	CreateTime time.Time `json:"createtime"`
+}
+
+// Validate check the silence is valid or not.
+func (s *Silence) Validate() error {
+	if s.Ns == "" {
+		return errors.New("silence has no ns")
+	}
+	if s.Creator == "" {
+		return errors.New("silence has no creator")
+	}
+	if s.EndTime.IsZero() || !s.EndTime.After(s.StartTime) {
+		return errors.New("silence endtime should be after starttime")
+	}
+	// the silence key expires after the endtime, the past endtime can not be kept.
+	if !s.EndTime.After(time.Now()) {
+		return errors.New("silence endtime should be after now")
+	}
+	return nil
+}
+
+// Active return the silence is active at time t or not.
+func (s *Silence) Active(t time.Time) bool {
+	return !t.Before(s.StartTime) && t.Before(s.EndTime)
+}
+
+// Match return the silence match the ns/alarm/host/tags or not.
+func (s *Silence) Match(ns, alarmVersion, alarmName, host string, tags map[string]string) bool {
+	if s.NsSubtree {
+		if !strings.HasSuffix("."+ns, "."+s.Ns) {
+			return false
+		}
+	} else if s.Ns != ns {
+		return false
+	}
+
+	if s.Alarm != "" && s.Alarm != alarmVersion && s.Alarm != alarmName {
+		return false
+	}
+	if s.Host != "" && s.Host != host {
+		return false
+	}
+	for k, v := range s.Tags {
+		if tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
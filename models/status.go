@@ -22,6 +22,21 @@ type Status struct {
 	TagString    string
 	Reciever     []string
 
+	// Silenced is true if the notify of the status is muted by silence.
+	Silenced  bool
+	SilenceID string
+
+	// Flapping is true if the level of the status changes too frequently,
+	// the notify of the status is suppressed while flapping.
+	Flapping bool
+
+	// SuppressReason is why the notify of the status is suppressed,
+	// such as out of the active window of the alarm.
+	SuppressReason string `json:",omitempty"`
+
+	// Ack is not nil if the status is acknowledged, it is kept in the ack key.
+	Ack *Ack `json:",omitempty"`
+
 	CTime      string
 	UTime      string
 	LastTime   time.Duration // unit: second
@@ -47,3 +62,22 @@ func (s *Status) String() (string, error) {
 	b, err := jsoniter.Marshal(s)
 	return string(b), err
 }
+
+// Ack is the acknowledgement of a status.
+// Repeat notify of the same level is suppressed while acknowledged.
+type Ack struct {
+	User string    `json:"user"`
+	Time time.Time `json:"time"`
+	Note string    `json:"note"`
+}
+
+// NewAckByString unmarshal the ack.
+func NewAckByString(input string) (ack Ack, err error) {
+	err = jsoniter.Unmarshal([]byte(input), &ack)
+	return
+}
+
+func (a *Ack) String() (string, error) {
+	b, err := jsoniter.Marshal(a)
+	return string(b), err
+}
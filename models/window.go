@@ -0,0 +1,122 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ActiveWindow is the daily time window the alarm notifies in.
+type ActiveWindow struct {
+	From int // unit: minute of day
+	To   int // unit: minute of day
+	// Days is the weekday mask the window starts on, bit n is time.Weekday(n).
+	Days uint8
+
+	desc string
+}
+
+// ParseActiveWindow parse the alarm starttime/endtime as active window.
+// The clock is "15:04" or "15:04:05", the window crosses midnight if end is before start.
+// The start can be prefixed by a weekday list such as "mon-fri 09:00" or "sat,sun 10:00",
+// the weekdays are the days the window starts on.
+// Return ok is false if the alarm has no window, it notifies all the time.
+func ParseActiveWindow(start, end string) (w ActiveWindow, ok bool, err error) {
+	start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+	if start == "" && end == "" {
+		return w, false, nil
+	}
+	w.Days = 0x7f
+	if i := strings.LastIndex(start, " "); i > 0 {
+		if w.Days, err = parseWeekdays(start[:i]); err != nil {
+			return w, false, err
+		}
+		start = strings.TrimSpace(start[i+1:])
+	}
+	if start == "" {
+		start = "00:00"
+	}
+	if end == "" {
+		end = "00:00"
+	}
+	if w.From, err = parseClock(start); err != nil {
+		return w, false, err
+	}
+	if w.To, err = parseClock(end); err != nil {
+		return w, false, err
+	}
+	if w.From == w.To && w.Days == 0x7f {
+		return w, false, nil
+	}
+	w.desc = start + "-" + end
+	return w, true, nil
+}
+
+func parseClock(clock string) (int, error) {
+	for _, format := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(format, clock); err == nil {
+			return t.Hour()*60 + t.Minute(), nil
+		}
+	}
+	return 0, errors.New("invalid clock: " + clock)
+}
+
+// parseWeekdays parse weekday list such as "mon-fri" or "mon,wed,fri" as mask.
+func parseWeekdays(input string) (uint8, error) {
+	var mask uint8
+	for _, item := range strings.Split(strings.ToLower(input), ",") {
+		item = strings.TrimSpace(item)
+		from, to := item, item
+		if i := strings.Index(item, "-"); i > 0 {
+			from, to = item[:i], item[i+1:]
+		}
+		fromDay, ok1 := weekdays[from]
+		toDay, ok2 := weekdays[to]
+		if !ok1 || !ok2 {
+			return 0, errors.New("invalid weekday: " + item)
+		}
+		for d := fromDay; ; d = (d + 1) % 7 {
+			mask |= 1 << uint(d)
+			if d == toDay {
+				break
+			}
+		}
+	}
+	return mask, nil
+}
+
+// Active return t is in the window or not.
+// The part after midnight of a crossing window belongs to the day it starts on.
+func (w *ActiveWindow) Active(t time.Time) bool {
+	if w.From == w.To {
+		// all day of the weekdays.
+		return w.Days&(1<<uint(t.Weekday())) != 0
+	}
+	if !InDailyWindow(t, w.From, w.To) {
+		return false
+	}
+	day := t.Weekday()
+	if w.From > w.To && t.Hour()*60+t.Minute() < w.To {
+		day = (day + 6) % 7
+	}
+	return w.Days&(1<<uint(day)) != 0
+}
+
+// String return the description of the window.
+func (w *ActiveWindow) String() string {
+	if w.Days == 0x7f {
+		return w.desc
+	}
+	days := make([]string, 0, 7)
+	for _, name := range []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"} {
+		if w.Days&(1<<uint(weekdays[name])) != 0 {
+			days = append(days, name)
+		}
+	}
+	return strings.Join(days, ",") + " " + w.desc
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseActiveWindow(t *testing.T) {
+	if _, ok, err := ParseActiveWindow("", ""); ok || err != nil {
+		t.Fatalf("empty window: %v %v", ok, err)
+	}
+	if _, ok, err := ParseActiveWindow("09:00", "09:00"); ok || err != nil {
+		t.Fatalf("all day window: %v %v", ok, err)
+	}
+	for _, c := range [][2]string{{"9am", "18:00"}, {"09:00", "25:00"}, {"xyz 09:00", "18:00"}, {"mon-xyz 09:00", "18:00"}} {
+		if _, _, err := ParseActiveWindow(c[0], c[1]); err == nil {
+			t.Fatalf("expect error of %s-%s", c[0], c[1])
+		}
+	}
+	w, ok, err := ParseActiveWindow("sat,sun 10:00", "12:00:00")
+	if err != nil || !ok {
+		t.Fatalf("parse: %v %v", ok, err)
+	}
+	if w.From != 600 || w.To != 720 || w.Days != 1<<uint(time.Sunday)|1<<uint(time.Saturday) {
+		t.Fatalf("unexpected window: %+v", w)
+	}
+	if s := w.String(); s != "sun,sat 10:00-12:00:00" {
+		t.Fatalf("unexpected description: %s", s)
+	}
+}
+
+func TestActiveWindow(t *testing.T) {
+	// 2026-10-16 is Friday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+	for _, c := range []struct {
+		start, end string
+		t          time.Time
+		active     bool
+	}{
+		{"09:00", "18:00", at(16, 9, 0), true},
+		{"09:00", "18:00", at(16, 17, 59), true},
+		{"09:00", "18:00", at(16, 18, 0), false},
+		{"09:00", "18:00", at(16, 8, 59), false},
+		// cross midnight.
+		{"22:00", "06:00", at(16, 23, 0), true},
+		{"22:00", "06:00", at(17, 5, 59), true},
+		{"22:00", "06:00", at(17, 6, 0), false},
+		// the part after midnight belongs to the day the window starts on.
+		{"mon-fri 22:00", "06:00", at(17, 5, 0), true},
+		{"mon-fri 22:00", "06:00", at(17, 23, 0), false},
+		{"mon-fri 22:00", "06:00", at(19, 5, 0), false},
+		// all day of the weekdays.
+		{"sat,sun 00:00", "00:00", at(17, 12, 0), true},
+		{"sat,sun 00:00", "00:00", at(16, 12, 0), false},
+	} {
+		w, ok, err := ParseActiveWindow(c.start, c.end)
+		if err != nil || !ok {
+			t.Fatalf("parse %s-%s: %v %v", c.start, c.end, ok, err)
+		}
+		if active := w.Active(c.t); active != c.active {
+			t.Fatalf("window %s-%s at %s: expect active %v", c.start, c.end, c.t.Format("Mon 15:04"), c.active)
+		}
+	}
+}
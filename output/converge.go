@@ -0,0 +1,189 @@
+package output
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+)
+
+const (
+	// GroupByNs converge the notify of the same ns.
+	GroupByNs = "ns"
+	// GroupByAlarm converge the notify of the same ns/alarm.
+	GroupByAlarm = "alarm"
+	// GroupByHost converge the notify of the same ns/host.
+	GroupByHost = "host"
+)
+
+var converger = &convergence{buckets: make(map[string]*bucket)}
+
+// convergence group the notify per receiver and channel in a window.
+// The first notify of the window is sent immediately,
+// the others are sent as one digest when the window ends.
+type convergence struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket keep the notify of one receiver/channel/group in the window.
+type bucket struct {
+	channel  string
+	receiver string
+	window   time.Duration
+	items    []models.NotifyData
+}
+
+// convergePolicy return the window and grouping key of the notify.
+// The rule of alarm is preferred, then the rule of the nearest ns.
+func convergePolicy(notifyData models.NotifyData) (time.Duration, string) {
+	conf := config.GetConfig().Convergence
+	window, groupBy := conf.Window, conf.GroupBy
+
+	var matched *config.ConvergenceRule
+	for i, rule := range conf.Rules {
+		if rule.Ns != "" && !strings.HasSuffix("."+notifyData.Ns, "."+rule.Ns) {
+			continue
+		}
+		if rule.Alarm != "" && rule.Alarm != notifyData.AlarmName {
+			continue
+		}
+		if matched == nil || preferRule(rule, *matched) {
+			matched = &conf.Rules[i]
+		}
+	}
+	if matched != nil {
+		window = matched.Window
+		if matched.GroupBy != "" {
+			groupBy = matched.GroupBy
+		}
+	}
+	return time.Duration(window) * time.Second, groupBy
+}
+
+// preferRule return r is preferred to q or not.
+func preferRule(r, q config.ConvergenceRule) bool {
+	if (r.Alarm != "") != (q.Alarm != "") {
+		return r.Alarm != ""
+	}
+	return len(r.Ns) > len(q.Ns)
+}
+
+func groupKey(notifyData models.NotifyData, groupBy string) string {
+	switch groupBy {
+	case GroupByNs:
+		return notifyData.Ns
+	case GroupByHost:
+		return notifyData.Ns + "/" + notifyData.Host
+	default:
+		return notifyData.Ns + "/" + notifyData.AlarmName
+	}
+}
+
+// Converge split the notify per receiver, return the notify to send immediately.
+// The notify of the receivers already notified in the window is kept to the digest.
+func (c *convergence) Converge(channel string, notifyData models.NotifyData) (models.NotifyData, bool) {
+	// ad-hoc message and digest is not converged.
+	if notifyData.Msg != "" || len(notifyData.Digest) != 0 || len(notifyData.Receivers) == 0 {
+		return notifyData, true
+	}
+	window, groupBy := convergePolicy(notifyData)
+	if window <= 0 {
+		return notifyData, true
+	}
+
+	group := groupKey(notifyData, groupBy)
+	immediate := make([]string, 0, len(notifyData.Receivers))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, receiver := range notifyData.Receivers {
+		key := channel + "/" + receiver + "/" + group
+		if b, ok := c.buckets[key]; ok {
+			b.items = append(b.items, notifyData)
+			continue
+		}
+		c.buckets[key] = &bucket{channel: channel, receiver: receiver, window: window}
+		time.AfterFunc(window, func() { c.flush(key) })
+		immediate = append(immediate, receiver)
+	}
+
+	if len(immediate) == 0 {
+		return notifyData, false
+	}
+	notifyData.Receivers = immediate
+	return notifyData, true
+}
+
+// flush send the digest of the bucket when the window end.
+// The bucket is kept for another window if it has digest to send.
+func (c *convergence) flush(key string) {
+	c.mu.Lock()
+	b, ok := c.buckets[key]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	if len(b.items) == 0 {
+		delete(c.buckets, key)
+		c.mu.Unlock()
+		return
+	}
+	items := b.items
+	b.items = nil
+	time.AfterFunc(b.window, func() { c.flush(key) })
+	c.mu.Unlock()
+
+	digest := newDigest(b.receiver, items)
+	if p, err := getPool(b.channel); err != nil {
+		log.Errorf("send digest of %s fail: %s", key, err.Error())
+	} else if err := p.Submit(digest); err != nil {
+		log.Errorf("send digest of %s fail: %s", key, err.Error())
+	}
+}
+
+// flushAll send the digests of all buckets immediately, it is called on shutdown.
+func (c *convergence) flushAll() {
+	c.mu.Lock()
+	buckets := c.buckets
+	c.buckets = make(map[string]*bucket)
+	c.mu.Unlock()
+
+	for key, b := range buckets {
+		if len(b.items) == 0 {
+			continue
+		}
+		p, err := getPool(b.channel)
+		if err == nil {
+			err = p.Submit(newDigest(b.receiver, b.items))
+		}
+		if err != nil {
+			log.Errorf("send digest of %s on shutdown fail: %s", key, err.Error())
+		}
+	}
+}
+
+// newDigest return the notify summary the items.
+func newDigest(receiver string, items []models.NotifyData) models.NotifyData {
+	last := items[len(items)-1]
+	digest := models.NotifyData{
+		Receivers:   []string{receiver},
+		Ns:          last.Ns,
+		AlarmName:   last.AlarmName,
+		Measurement: last.Measurement,
+		Level:       last.Level,
+		Time:        last.Time,
+		Digest:      items,
+	}
+	for _, item := range items {
+		if item.Ns != digest.Ns {
+			digest.Ns = ""
+		}
+		if item.AlarmName != digest.AlarmName {
+			digest.AlarmName, digest.Measurement = "", ""
+		}
+	}
+	return digest
+}
@@ -0,0 +1,84 @@
+package output
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/loda"
+	"github.com/lodastack/event/models"
+)
+
+func TestConverge(t *testing.T) {
+	config.GetConfig().Convergence = config.ConvergenceConfig{Window: 60, GroupBy: GroupByAlarm}
+	defer func() { config.GetConfig().Convergence = config.ConvergenceConfig{} }()
+	for _, user := range []string{"alice", "bob", "carol"} {
+		loda.UserMap[user] = loda.User{Username: user}
+	}
+	sent := make(chan models.NotifyData, 10)
+	poolsMu.Lock()
+	pools["test"] = newPool("test", func(ctx context.Context, notifyData models.NotifyData) error {
+		sent <- notifyData
+		return nil
+	}, config.PoolConfig{})
+	poolsMu.Unlock()
+	defer func() {
+		poolsMu.Lock()
+		delete(pools, "test")
+		poolsMu.Unlock()
+	}()
+
+	c := &convergence{buckets: make(map[string]*bucket)}
+	notify := func(alarm, host string, receivers ...string) (models.NotifyData, bool) {
+		return c.Converge("test", models.NotifyData{Ns: "a.loda", AlarmName: alarm, Host: host, Level: "CRITICAL", Receivers: receivers})
+	}
+
+	if output, ok := notify("cpu", "h1", "alice", "bob"); !ok || len(output.Receivers) != 2 {
+		t.Fatalf("the first notify is sent immediately: %v %+v", ok, output)
+	}
+	if output, ok := notify("cpu", "h2", "alice", "carol"); !ok || len(output.Receivers) != 1 || output.Receivers[0] != "carol" {
+		t.Fatalf("only the receiver not notified is sent immediately: %v %+v", ok, output)
+	}
+	if _, ok := notify("cpu", "h3", "alice", "bob"); ok {
+		t.Fatal("the notify of receivers notified is converged")
+	}
+	if output, ok := notify("mem", "h1", "alice"); !ok || len(output.Receivers) != 1 {
+		t.Fatalf("the notify of other group is sent immediately: %v %+v", ok, output)
+	}
+	if output, ok := c.Converge("test", models.NotifyData{Ns: "a.loda", AlarmName: "cpu", Msg: "hi", Receivers: []string{"alice"}}); !ok || output.Msg != "hi" {
+		t.Fatal("the ad-hoc message is not converged")
+	}
+
+	// the window of alice ends, send the digest of h2 and h3.
+	c.flush("test/alice/a.loda/cpu")
+	select {
+	case digest := <-sent:
+		if len(digest.Receivers) != 1 || digest.Receivers[0] != "alice" || len(digest.Digest) != 2 ||
+			digest.Digest[0].Host != "h2" || digest.Digest[1].Host != "h3" || digest.AlarmName != "cpu" {
+			t.Fatalf("unexpected digest: %+v", digest)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("digest is not sent")
+	}
+	// the bucket is kept for another window after the digest, the empty bucket is removed.
+	if _, ok := notify("cpu", "h4", "alice"); ok {
+		t.Fatal("the notify is converged in the window after digest")
+	}
+	c.flush("test/bob/a.loda/cpu")
+	c.flush("test/bob/a.loda/cpu")
+	if output, ok := notify("cpu", "h5", "bob"); !ok || len(output.Receivers) != 1 {
+		t.Fatalf("the notify after the window is sent immediately: %v %+v", ok, output)
+	}
+}
+
+func TestNewDigest(t *testing.T) {
+	items := []models.NotifyData{
+		{Ns: "a.loda", AlarmName: "cpu", Measurement: "cpu.idle", Level: "WARNING"},
+		{Ns: "a.loda", AlarmName: "mem", Measurement: "mem.used", Level: "CRITICAL"},
+	}
+	digest := newDigest("alice", items)
+	if digest.Ns != "a.loda" || digest.AlarmName != "" || digest.Measurement != "" || digest.Level != "CRITICAL" || len(digest.Digest) != 2 {
+		t.Fatalf("unexpected digest: %+v", digest)
+	}
+}
@@ -0,0 +1,212 @@
+// Package i18n translate the notify content by the locale of receivers.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/loda"
+	"github.com/lodastack/event/models"
+)
+
+// The supported locales.
+const (
+	EnUS = "en-US"
+	ZhCN = "zh-CN"
+
+	defaultLocale = EnUS
+
+	timeFormat = "2006-01-02 15:04:05"
+)
+
+// channelDefaults is the locale of the channel if no locale configured,
+// it keeps the language of the channel before translated, wechat was in Chinese.
+var channelDefaults = map[string]string{
+	"wechat": ZhCN,
+}
+
+// The message keys of catalogs.
+const (
+	KeyAlert         = "alert"
+	KeyRecovered     = "recovered"
+	KeyContent       = "content"
+	KeyNs            = "ns"
+	KeyIP            = "ip"
+	KeyMeasurement   = "measurement"
+	KeyValue         = "value"
+	KeyTime          = "time"
+	KeyLasted        = "lasted"
+	KeyConvergence   = "convergence"
+	KeyAlerts        = "alerts"
+	KeySubjectPrefix = "subject_prefix"
+	// KeyAcked is the format of ack by the user and time.
+	KeyAcked = "acked"
+)
+
+// catalogs is the messages of every locale, key of message is the message key or level name.
+var catalogs = map[string]map[string]string{
+	EnUS: {
+		KeyAlert:         "Alert",
+		KeyRecovered:     "Recovered",
+		KeyContent:       "Content",
+		KeyNs:            "ns",
+		KeyIP:            "ip",
+		KeyMeasurement:   "measurement",
+		KeyValue:         "value",
+		KeyTime:          "time",
+		KeyLasted:        "lasted",
+		KeyConvergence:   "convergence",
+		KeyAlerts:        "alerts",
+		KeySubjectPrefix: "[monitor]",
+		KeyAcked:         "acked by %s at %s",
+
+		"OK":           "OK",
+		"INFO":         "INFO",
+		"WARN":         "WARN",
+		"WARNING":      "WARNING",
+		"CRIT":         "CRIT",
+		"CRITICAL":     "CRITICAL",
+		"Unknow Level": "Unknow Level",
+	},
+	ZhCN: {
+		KeyAlert:         "报警",
+		KeyRecovered:     "恢复",
+		KeyContent:       "内容",
+		KeyNs:            "节点",
+		KeyIP:            "IP",
+		KeyMeasurement:   "指标",
+		KeyValue:         "当前值",
+		KeyTime:          "时间",
+		KeyLasted:        "持续",
+		KeyConvergence:   "收敛",
+		KeyAlerts:        "条报警",
+		KeySubjectPrefix: "[监控]",
+		KeyAcked:         "%s 已于 %s 确认",
+
+		"OK":           "恢复正常",
+		"INFO":         "提示",
+		"WARN":         "警告",
+		"WARNING":      "警告",
+		"CRIT":         "严重",
+		"CRITICAL":     "严重",
+		"Unknow Level": "未知级别",
+	},
+}
+
+// normalize return the supported locale of the input, such as zh_cn to zh-CN.
+// Return empty if the locale is not supported.
+func normalize(locale string) string {
+	locale = strings.Replace(strings.TrimSpace(locale), "_", "-", -1)
+	for supported := range catalogs {
+		if strings.EqualFold(supported, locale) {
+			return supported
+		}
+	}
+	// match by language, such as zh to zh-CN.
+	for supported := range catalogs {
+		if locale != "" && strings.EqualFold(strings.SplitN(supported, "-", 2)[0], locale) {
+			return supported
+		}
+	}
+	return ""
+}
+
+// T return the message of key in the locale, fallback to en-US and then the key itself.
+func T(locale, key string) string {
+	if msg, ok := catalogs[normalize(locale)][key]; ok {
+		return msg
+	}
+	if msg, ok := catalogs[defaultLocale][key]; ok {
+		return msg
+	}
+	return key
+}
+
+// Ack return the ack infomation used in notify content in the locale.
+func Ack(locale string, ack *models.Ack) string {
+	if ack == nil {
+		return ""
+	}
+	desc := fmt.Sprintf(T(locale, KeyAcked), ack.User, ack.Time.Format(timeFormat))
+	if ack.Note != "" {
+		desc += ": " + ack.Note
+	}
+	return desc
+}
+
+// Locales return the supported locales.
+func Locales() []string {
+	output := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		output = append(output, locale)
+	}
+	sort.Strings(output)
+	return output
+}
+
+// Locale return the locale of the user receiving the notify of ns by the channel.
+// The local override of user is preferred, then the user record in registry,
+// then the locale of the nearest ns, then the global default, and then the channel default.
+func Locale(channel, user, ns string, users map[string]loda.User) string {
+	conf := config.GetConfig().I18n
+	if locale := normalize(conf.Users[user]); locale != "" {
+		return locale
+	}
+	if locale := normalize(users[user].Locale); locale != "" {
+		return locale
+	}
+	return nsLocale(channel, ns)
+}
+
+// nsLocale return the locale of the nearest ns, or the global default.
+func nsLocale(channel, ns string) string {
+	conf := config.GetConfig().I18n
+	var matched string
+	for parentNs, locale := range conf.Ns {
+		if !strings.HasSuffix("."+ns, "."+parentNs) || len(parentNs) <= len(matched) {
+			continue
+		}
+		if normalize(locale) != "" {
+			matched = parentNs
+		}
+	}
+	if matched != "" {
+		return normalize(conf.Ns[matched])
+	}
+	if locale := normalize(conf.Default); locale != "" {
+		return locale
+	}
+	if locale, ok := channelDefaults[channel]; ok {
+		return locale
+	}
+	return defaultLocale
+}
+
+// Split split the notify data of the channel by the locale of its receivers.
+// The notify data without receivers use the locale of its ns.
+func Split(channel string, notifyData models.NotifyData) []models.NotifyData {
+	if len(notifyData.Receivers) == 0 {
+		notifyData.Locale = nsLocale(channel, notifyData.Ns)
+		return []models.NotifyData{notifyData}
+	}
+	users, _ := loda.GetUsers(notifyData.Receivers)
+
+	receivers := make(map[string][]string)
+	locales := make([]string, 0, 1)
+	for _, user := range notifyData.Receivers {
+		locale := Locale(channel, user, notifyData.Ns, users)
+		if _, ok := receivers[locale]; !ok {
+			locales = append(locales, locale)
+		}
+		receivers[locale] = append(receivers[locale], user)
+	}
+
+	output := make([]models.NotifyData, len(locales))
+	for i, locale := range locales {
+		output[i] = notifyData
+		output[i].Receivers, output[i].Locale = receivers[locale], locale
+	}
+	return output
+}
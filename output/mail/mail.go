@@ -2,30 +2,35 @@ package mail
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/smtp"
 	"runtime"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/lodastack/log"
 
 	"github.com/lodastack/event/config"
 	"github.com/lodastack/event/loda"
+	"github.com/lodastack/event/metrics"
 	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/output/i18n"
+	"github.com/lodastack/event/output/tmpl"
 )
 
 const (
 	timeFormat     = "2006-01-02 15:04:05"
 	defaultSubject = "monitor alert"
 	OK             = "OK"
-
-	multi = "convergence"
 )
 
 var mailSuffix, mailSubject string
 
-func SendEMail(notifyData models.NotifyData) error {
+// SendEMail send the notify mail to receivers, the mail is not sent if ctx is done,
+// a started SMTP transaction is not interrupted.
+func SendEMail(ctx context.Context, notifyData models.NotifyData) error {
 	var revieve []string
 	mailSuffix = config.GetConfig().Mail.MailSuffix
 
@@ -55,11 +60,14 @@ func SendEMail(notifyData models.NotifyData) error {
 		log.Errorf("getPngBase64 fail, msg: %+v, err: %+v, length: %d", notifyData, err, len(pngBase64))
 	}
 
-	// deploy case
-	if notifyData.Msg != "" {
+	// deploy case and digest
+	if notifyData.Msg != "" || len(notifyData.Digest) > 0 {
 		addPng = false
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return SendMail(config.GetConfig().Mail.Host,
 		config.GetConfig().Mail.Port,
 		config.GetConfig().Mail.User,
@@ -73,18 +81,41 @@ func SendEMail(notifyData models.NotifyData) error {
 	)
 }
 
+// Preview return the mail subject and content of the notify data.
+func Preview(notifyData models.NotifyData) (string, string) {
+	return genMailSubject(notifyData), genMailContent(notifyData)
+}
+
 func genMailSubject(notifyData models.NotifyData) string {
+	locale := notifyData.Locale
+	prefix := config.GetConfig().Mail.SubjectPrefix
+	if prefix == "" {
+		prefix = i18n.T(locale, i18n.KeySubjectPrefix)
+	}
+	if subject, ok := tmpl.Subject(tmpl.Mail, notifyData); ok {
+		return prefix + " " + subject
+	}
 	if notifyData.Msg != "" {
 		return notifyData.AlarmName
 	}
+	if len(notifyData.Digest) > 0 {
+		return fmt.Sprintf("%s %s %s   %d %s",
+			prefix, i18n.T(locale, i18n.KeyConvergence), notifyData.AlarmName, len(notifyData.Digest), i18n.T(locale, i18n.KeyAlerts))
+	}
 	return fmt.Sprintf("%s %s   %s   is  %s",
-		config.GetConfig().Mail.SubjectPrefix, notifyData.Host, notifyData.Measurement, notifyData.Level)
+		prefix, notifyData.Host, notifyData.Measurement, i18n.T(locale, notifyData.Level))
 }
 
 func genMailContent(notifyData models.NotifyData) string {
+	if content, ok := tmpl.Content(tmpl.Mail, notifyData); ok {
+		return content
+	}
 	if notifyData.Msg != "" {
 		return strings.Replace(notifyData.Msg, "\n", "</br>", -1)
 	}
+	if len(notifyData.Digest) > 0 {
+		return strings.Join(notifyData.DigestLines(timeFormat), "</br>")
+	}
 	var tagDescribe string
 	if len(notifyData.Tags) > 0 {
 		for k, v := range notifyData.Tags {
@@ -99,20 +130,25 @@ func genMailContent(notifyData models.NotifyData) string {
 	} else {
 		levelColor = "red"
 	}
-	status := fmt.Sprintf("<font style=\"color:%s\">%s</font>", levelColor, notifyData.Level)
+	locale := notifyData.Locale
+	status := fmt.Sprintf("<font style=\"color:%s\">%s</font>", levelColor, i18n.T(locale, notifyData.Level))
 
 	var ipDesc string
 	if notifyData.IP != "" {
-		ipDesc = "</br>ip: " + notifyData.IP
+		ipDesc = "</br>" + i18n.T(locale, i18n.KeyIP) + ": " + notifyData.IP
 	}
-	return fmt.Sprintf("%s\t%s</br></br>ns: %s%s</br>%s </br>value: %.2f </br></br>time: %v",
+	content := fmt.Sprintf("%s\t%s</br></br>%s: %s%s</br>%s </br>%s: %.2f </br></br>%s: %v",
 		notifyData.AlarmName,
 		status,
-		notifyData.Ns,
+		i18n.T(locale, i18n.KeyNs), notifyData.Ns,
 		ipDesc,
 		tagDescribe,
-		notifyData.Value,
-		notifyData.Time.Format(timeFormat))
+		i18n.T(locale, i18n.KeyValue), notifyData.Value,
+		i18n.T(locale, i18n.KeyTime), notifyData.Time.Format(timeFormat))
+	if notifyData.Ack != nil {
+		content += "</br>" + i18n.Ack(locale, notifyData.Ack)
+	}
+	return content
 }
 
 func catchPanic(err *error, functionName string) {
@@ -161,12 +197,14 @@ func SendMail(host string, port int, userName string, password string, from stri
 	}
 	auth := LoginAuth(userName, password)
 
+	start := time.Now()
 	err = sendMail(
 		fmt.Sprintf("%s:%d", host, port),
 		auth,
 		from,
 		to,
 		buffer.Bytes())
+	metrics.OutputDuration.Since(start, "smtp")
 
 	if err != nil {
 		log.Errorf("send mail: to [%v] subject [%s] %s", to, subject, err)
@@ -1,9 +1,14 @@
 package output
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/lodastack/event/models"
 	"github.com/lodastack/event/output/mail"
 	"github.com/lodastack/event/output/sms"
+	"github.com/lodastack/event/output/tmpl"
+	"github.com/lodastack/event/output/webhook"
 	"github.com/lodastack/event/output/wechat"
 )
 
@@ -12,8 +17,31 @@ func init() {
 	Handlers["mail"] = mail.SendEMail
 	Handlers["sms"] = sms.SendSMS
 	Handlers["wechat"] = wechat.SendWechat
+	Handlers[Webhook] = webhook.SendWebhook
+
+	tmpl.GraphLink = mail.PngLink
 }
 
-type HandleFunc func(alertMsg models.NotifyData) error
+// Webhook is the alert type to post notify data to the webhooks of alarm.
+const Webhook = "webhook"
+
+// HandleFunc send the notify data, the sending is abandoned if ctx is done.
+type HandleFunc func(ctx context.Context, alertMsg models.NotifyData) error
 
 var Handlers map[string]HandleFunc
+
+// Preview return the subject and content of the notify data rendered by the channel.
+// The subject is empty if the channel has no subject.
+func Preview(channel string, notifyData models.NotifyData) (subject, content string, err error) {
+	switch channel {
+	case tmpl.Mail:
+		subject, content = mail.Preview(notifyData)
+	case tmpl.Wechat:
+		subject, content = wechat.Preview(notifyData)
+	case tmpl.SMS:
+		content = sms.Preview(notifyData)
+	default:
+		err = fmt.Errorf("channel %s has no template", channel)
+	}
+	return
+}
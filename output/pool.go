@@ -0,0 +1,406 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/metrics"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/output/i18n"
+	"github.com/lodastack/event/queue"
+	"github.com/lodastack/log"
+)
+
+const (
+	// PolicyDropOldest drop the oldest queued notify if the pool queue is full.
+	PolicyDropOldest = "dropoldest"
+	// PolicyReject reject the new notify if the pool queue is full.
+	PolicyReject = "reject"
+	// PolicySpill spill the new notify to disk if the pool queue is full.
+	PolicySpill = "spill"
+
+	defaultPoolWorkers = 4
+	defaultPoolQueue   = 1000
+
+	// drainInterval is the interval to check the pool is drained on shutdown.
+	drainInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrPoolFull is returned if the notify is rejected by the full pool.
+	ErrPoolFull = errors.New("output pool is full")
+	// ErrPoolClosed is returned if the notify is submitted after shutdown.
+	ErrPoolClosed = errors.New("output pool is closed")
+
+	pools       = make(map[string]*Pool)
+	poolsMu     sync.Mutex
+	poolsClosed bool
+
+	// sendCtx is passed to the handlers, it is canceled to abandon the running notify
+	// if the pools are not drained before the shutdown deadline.
+	sendCtx, abandonSending = context.WithCancel(context.Background())
+)
+
+// PoolStats is the utilization of a pool.
+type PoolStats struct {
+	Workers     int     `json:"workers"`
+	Busy        int     `json:"busy"`
+	Queued      int     `json:"queued"`
+	Capacity    int     `json:"capacity"`
+	Spilled     int     `json:"spilled"`
+	Policy      string  `json:"policy"`
+	Utilization float64 `json:"utilization"`
+
+	Processed uint64 `json:"processed"`
+	Failed    uint64 `json:"failed"`
+	Dropped   uint64 `json:"dropped"`
+	Rejected  uint64 `json:"rejected"`
+}
+
+// Pool is a bounded worker pool to run one output handler.
+type Pool struct {
+	name    string
+	handler HandleFunc
+	workers int
+	size    int
+	policy  string
+	spill   *queue.Queue
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	tasks  []models.NotifyData
+	stats  PoolStats
+	closed bool
+	// spilled is the number of notify in or pushing to the spill queue,
+	// the new notify is spilled too until they are moved back to keep the order.
+	spilled int
+}
+
+// newPool create pool for the handler and start its workers.
+func newPool(name string, handler HandleFunc, conf config.PoolConfig) *Pool {
+	p := &Pool{
+		name:    name,
+		handler: handler,
+		workers: conf.Workers,
+		size:    conf.Queue,
+		policy:  conf.Policy,
+	}
+	if p.workers < 1 {
+		p.workers = defaultPoolWorkers
+	}
+	if p.size < 1 {
+		p.size = defaultPoolQueue
+	}
+	switch p.policy {
+	case PolicyReject, PolicyDropOldest:
+	case PolicySpill:
+		spillDir := config.GetConfig().Com.SpillDir
+		q, err := queue.Open(filepath.Join(spillDir, name+".db"))
+		if err != nil {
+			log.Errorf("open spill queue of pool %s fail, use %s policy: %s", name, PolicyDropOldest, err.Error())
+			p.policy = PolicyDropOldest
+			break
+		}
+		p.spill = q
+		p.spilled = q.Stats().Depth
+	default:
+		p.policy = PolicyDropOldest
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	for i := 0; i < p.workers; i++ {
+		go p.work()
+	}
+	if p.spill != nil {
+		p.spill.Consume(1, 0, p.unspill)
+	}
+	return p
+}
+
+// Submit put the notify data to the pool queue, handle the overflow by the pool policy.
+func (p *Pool) Submit(notifyData models.NotifyData) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	if p.spill != nil && p.spilled > 0 {
+		p.spilled++
+		p.mu.Unlock()
+		return p.spillNotify(notifyData)
+	}
+	if len(p.tasks) < p.size {
+		p.tasks = append(p.tasks, notifyData)
+		p.cond.Signal()
+		p.mu.Unlock()
+		return nil
+	}
+
+	switch p.policy {
+	case PolicyReject:
+		p.stats.Rejected++
+		p.mu.Unlock()
+		return ErrPoolFull
+	case PolicySpill:
+		p.spilled++
+		p.mu.Unlock()
+		return p.spillNotify(notifyData)
+	default:
+		dropped := p.tasks[0]
+		p.tasks = append(p.tasks[1:], notifyData)
+		p.stats.Dropped++
+		p.cond.Signal()
+		p.mu.Unlock()
+		log.Errorf("output pool %s is full, drop oldest notify: ns %s alarm %s host %s",
+			p.name, dropped.Ns, dropped.AlarmName, dropped.Host)
+		return nil
+	}
+}
+
+// spillNotify push the notify to the spill queue, it is called without lock
+// and the spilled number is increased before.
+func (p *Pool) spillNotify(notifyData models.NotifyData) error {
+	data, err := json.Marshal(notifyData)
+	if err == nil {
+		err = p.spill.Push(data)
+	}
+	if err != nil {
+		p.mu.Lock()
+		p.spilled--
+		p.stats.Rejected++
+		p.mu.Unlock()
+		return fmt.Errorf("spill notify to disk fail: %s", err.Error())
+	}
+	return nil
+}
+
+// unspill move the spilled notify back to the pool queue when it has room,
+// otherwise ask the spill queue to retry later.
+func (p *Pool) unspill(data []byte) error {
+	var notifyData models.NotifyData
+	if err := json.Unmarshal(data, &notifyData); err != nil {
+		log.Errorf("unmarshal spilled notify fail, drop it: %s", err.Error())
+		p.mu.Lock()
+		p.spilled--
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.tasks) >= p.size {
+		return queue.ErrRetryLater
+	}
+	p.tasks = append(p.tasks, notifyData)
+	p.spilled--
+	p.cond.Signal()
+	return nil
+}
+
+// work handle the queued notify until the pool is closed and drained.
+func (p *Pool) work() {
+	for {
+		p.mu.Lock()
+		for len(p.tasks) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.tasks) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		notifyData := p.tasks[0]
+		p.tasks = p.tasks[1:]
+		p.stats.Busy++
+		p.mu.Unlock()
+
+		err := p.handle(notifyData)
+		if err != nil && sendCtx.Err() != nil {
+			log.Errorf("output %s is abandoned on shutdown: ns %s alarm %s host %s receivers %v",
+				p.name, notifyData.Ns, notifyData.AlarmName, notifyData.Host, notifyData.Receivers)
+		} else if err != nil {
+			log.Errorf("output %s fail: %s", p.name, err.Error())
+		}
+		metrics.Notifications.Inc(p.name, metrics.Result(err))
+
+		p.mu.Lock()
+		p.stats.Busy--
+		p.stats.Processed++
+		if err != nil {
+			p.stats.Failed++
+		}
+		p.mu.Unlock()
+	}
+}
+
+// handle the notify data by the handler per locale of receivers, except webhook.
+func (p *Pool) handle(notifyData models.NotifyData) error {
+	if p.name == Webhook {
+		return p.handler(sendCtx, notifyData)
+	}
+	var err error
+	for _, nd := range i18n.Split(p.name, notifyData) {
+		if e := p.handler(sendCtx, nd); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// drain stop accepting notify, and wait the queued and running notify finished until ctx is done.
+// Return the queued notify not handled.
+func (p *Pool) drain(ctx context.Context) []models.NotifyData {
+	// stop moving the spilled notify back to the queue, they are kept on disk.
+	if p.spill != nil {
+		p.spill.Stop()
+	}
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for {
+		p.mu.Lock()
+		if len(p.tasks) == 0 && p.stats.Busy == 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			p.mu.Lock()
+			left := p.tasks
+			p.tasks = nil
+			p.mu.Unlock()
+			return left
+		}
+	}
+}
+
+// persist spill the notify not handled to disk if the pool has spill queue,
+// they are sent after restart. Otherwise the notify is abandoned.
+func (p *Pool) persist(left []models.NotifyData) {
+	for _, notifyData := range left {
+		if p.spill != nil {
+			data, err := json.Marshal(notifyData)
+			if err == nil {
+				err = p.spill.Push(data)
+			}
+			if err == nil {
+				continue
+			}
+			log.Errorf("spill notify of output %s on shutdown fail: %s", p.name, err.Error())
+		}
+		log.Errorf("output %s is abandoned on shutdown: ns %s alarm %s host %s receivers %v",
+			p.name, notifyData.Ns, notifyData.AlarmName, notifyData.Host, notifyData.Receivers)
+	}
+	if p.spill != nil {
+		if len(left) != 0 {
+			log.Infof("output %s spill %d notify on shutdown", p.name, len(left))
+		}
+		if err := p.spill.Close(); err != nil {
+			log.Errorf("close spill queue of output %s fail: %s", p.name, err.Error())
+		}
+	}
+}
+
+// Stats return the utilization of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	s := p.stats
+	s.Workers, s.Capacity, s.Policy = p.workers, p.size, p.policy
+	s.Queued = len(p.tasks)
+	p.mu.Unlock()
+
+	if p.spill != nil {
+		s.Spilled = p.spill.Stats().Depth
+	}
+	s.Utilization = float64(s.Busy) / float64(s.Workers)
+	return s
+}
+
+// getPool return the pool of handler, create it if not exist.
+func getPool(name string) (*Pool, error) {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if poolsClosed {
+		return nil, ErrPoolClosed
+	}
+	if p, ok := pools[name]; ok {
+		return p, nil
+	}
+	handler, ok := Handlers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknow alert type %s", name)
+	}
+	p := newPool(name, handler, config.GetConfig().Pool[name])
+	pools[name] = p
+	return p, nil
+}
+
+// Submit put the notify data to the pool of the output handler.
+// The notify is converged per receiver except webhook.
+func Submit(name string, notifyData models.NotifyData) error {
+	p, err := getPool(name)
+	if err != nil {
+		return err
+	}
+	if name != Webhook {
+		var ok bool
+		if notifyData, ok = converger.Converge(name, notifyData); !ok {
+			return nil
+		}
+	}
+	return p.Submit(notifyData)
+}
+
+// PoolsStats return the utilization of all started pools.
+func PoolsStats() map[string]PoolStats {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	output := make(map[string]PoolStats, len(pools))
+	for name, p := range pools {
+		output[name] = p.Stats()
+	}
+	return output
+}
+
+// Shutdown send the pending digests, stop accepting notify and drain the pools until ctx is done.
+// The queued notify not sent is spilled to disk if the pool has spill queue, otherwise abandoned,
+// and the running notify is canceled when ctx is done.
+func Shutdown(ctx context.Context) {
+	converger.flushAll()
+
+	poolsMu.Lock()
+	poolsClosed = true
+	closing := make([]*Pool, 0, len(pools))
+	for _, p := range pools {
+		closing = append(closing, p)
+	}
+	poolsMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range closing {
+		wg.Add(1)
+		go func(p *Pool) {
+			defer wg.Done()
+			p.persist(p.drain(ctx))
+		}(p)
+	}
+	wg.Wait()
+
+	for _, p := range closing {
+		if busy := p.Stats().Busy; busy != 0 {
+			log.Errorf("output %s has %d running notify abandoned on shutdown", p.name, busy)
+		}
+	}
+	abandonSending()
+}
@@ -1,49 +1,80 @@
 package sms
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/lodastack/event/config"
 	"github.com/lodastack/event/loda"
+	"github.com/lodastack/event/metrics"
 	"github.com/lodastack/event/models"
-	"github.com/lodastack/log"
+	"github.com/lodastack/event/output/i18n"
+	"github.com/lodastack/event/output/tmpl"
 )
 
 const (
 	timeFormat = "2006-01-02 15:04:05"
 )
 
-func SendSMS(notifyData models.NotifyData) error {
+// SendSMS run the sms script for every receiver, the rest receivers are abandoned if ctx is done.
+// Return the errors of all receivers failed in one error.
+func SendSMS(ctx context.Context, notifyData models.NotifyData) error {
 	usermobiles := loda.GetUserMobile(notifyData.Receivers)
 	content := genSmsContent(notifyData)
 
+	// NOTE: SendSMS run in the sms output pool, send one by one to bound the script processes.
+	var errs []string
 	for user, mobile := range usermobiles {
-		go sendSMS(mobile, content, user)
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err.Error())
+			break
+		}
+		if err := sendSMS(ctx, mobile, content, user); err != nil {
+			errs = append(errs, user+": "+err.Error())
+		}
 	}
-	return nil
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New("send sms fail: " + strings.Join(errs, "; "))
 }
 
-func sendSMS(mobile, content, user string) {
+func sendSMS(ctx context.Context, mobile, content, user string) error {
 	if mobile == "" || len(mobile) != 11 {
-		log.Errorf("invalid mobile: %s", mobile)
-		return
+		return fmt.Errorf("invalid mobile: %s", mobile)
 	}
 	if _, err := os.Stat(config.GetConfig().Sms.Script); err != nil {
-		log.Errorf("not found send sms script: %s", config.GetConfig().Sms.Script)
-		return
+		return fmt.Errorf("not found send sms script: %s", config.GetConfig().Sms.Script)
 	}
-	if out, err := exec.Command("/bin/bash", config.GetConfig().Sms.Script, mobile, content, user).Output(); err != nil {
-		log.Errorf("run sms script error: %s, output: %s", err.Error(), string(out))
+	defer metrics.OutputDuration.Since(time.Now(), "sms_script")
+	if out, err := exec.CommandContext(ctx, "/bin/bash", config.GetConfig().Sms.Script, mobile, content, user).Output(); err != nil {
+		return fmt.Errorf("run sms script error: %s, output: %s", err.Error(), string(out))
 	}
+	return nil
+}
+
+// Preview return the sms content of the notify data.
+func Preview(notifyData models.NotifyData) string {
+	return genSmsContent(notifyData)
 }
 
 func genSmsContent(notifyData models.NotifyData) string {
+	if content, ok := tmpl.Content(tmpl.SMS, notifyData); ok {
+		return strings.Replace(content, "\n", "\r\n", -1)
+	}
 	if notifyData.Msg != "" {
 		return strings.Replace(notifyData.Msg, "\n", "\r\n", -1)
 	}
+	if len(notifyData.Digest) > 0 {
+		return fmt.Sprintf("%s: %d %s\r\n%s",
+			i18n.T(notifyData.Locale, i18n.KeyConvergence), len(notifyData.Digest), i18n.T(notifyData.Locale, i18n.KeyAlerts),
+			strings.Join(notifyData.DigestLines(timeFormat), "\r\n"))
+	}
 
 	var tagDescribe string
 	for k, v := range notifyData.Tags {
@@ -52,15 +83,20 @@ func genSmsContent(notifyData models.NotifyData) string {
 	if len(notifyData.Tags) > 1 {
 		tagDescribe = tagDescribe[:len(tagDescribe)-2]
 	}
-	return fmt.Sprintf("%s  %s\r\n%s  %s  %s\r\nns: %s\r\n%s \r\nvalue: %.2f \r\ntime: %v",
+	locale := notifyData.Locale
+	content := fmt.Sprintf("%s  %s\r\n%s  %s  %s\r\n%s: %s\r\n%s \r\n%s: %.2f \r\n%s: %v",
 		notifyData.AlarmName,
-		notifyData.Level,
+		i18n.T(locale, notifyData.Level),
 		notifyData.Host,
 		notifyData.Measurement,
 		notifyData.Expression,
 
-		notifyData.Ns,
+		i18n.T(locale, i18n.KeyNs), notifyData.Ns,
 		tagDescribe,
-		notifyData.Value,
-		notifyData.Time.Format(timeFormat))
+		i18n.T(locale, i18n.KeyValue), notifyData.Value,
+		i18n.T(locale, i18n.KeyTime), notifyData.Time.Format(timeFormat))
+	if notifyData.Ack != nil {
+		content += "\r\n" + i18n.Ack(locale, notifyData.Ack)
+	}
+	return content
 }
@@ -0,0 +1,148 @@
+package tmpl
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/output/i18n"
+)
+
+const timeFormat = "2006-01-02 15:04:05"
+
+// GraphLink return the graph link of the notify, it is set by output package.
+var GraphLink func(models.NotifyData) string
+
+// funcs is the helper function library of templates.
+var funcs = template.FuncMap{
+	"duration": humanizeDuration,
+	"value":    formatValue,
+	"time":     formatTime,
+	"tags":     formatTags,
+	"tagTable": tagTable,
+	"color":    levelColor,
+	"graph":    graphLink,
+	"link":     link,
+	"join":     strings.Join,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	// t translate the message key or level name by locale, such as {{t .Locale .Level}}.
+	"t": i18n.T,
+	// ack describe the ack by locale, such as {{ack .Locale .Ack}}.
+	"ack": i18n.Ack,
+}
+
+// humanizeDuration format the duration by the two largest units, such as "2d 3h" or "1h 5m".
+func humanizeDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Second {
+		return "0s"
+	}
+	parts := make([]string, 0, 4)
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}} {
+		if n := d / unit.d; n > 0 {
+			parts = append(parts, strconv.Itoa(int(n))+unit.name)
+			d -= n * unit.d
+		}
+	}
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatValue format the value with 2 decimals at most, and K/M/G suffix for the large value.
+func formatValue(v float64) string {
+	suffix := ""
+	for _, unit := range []struct {
+		base float64
+		name string
+	}{{1e9, "G"}, {1e6, "M"}, {1e3, "K"}} {
+		if v >= unit.base || v <= -unit.base {
+			v, suffix = v/unit.base, unit.name
+			break
+		}
+	}
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return s + suffix
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(timeFormat)
+}
+
+// sortedTags return the tags as "k=v" order by key.
+func sortedTags(tags map[string]string) []string {
+	output := make([]string, 0, len(tags))
+	for k, v := range tags {
+		output = append(output, k+"="+v)
+	}
+	sort.Strings(output)
+	return output
+}
+
+// formatTags format the tags as "k1=v1, k2=v2".
+func formatTags(tags map[string]string) string {
+	return strings.Join(sortedTags(tags), ", ")
+}
+
+// tagTable format the tags as html table.
+func tagTable(tags map[string]string) htmltemplate.HTML {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("<table>")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td></tr>",
+			htmltemplate.HTMLEscapeString(k), htmltemplate.HTMLEscapeString(tags[k]))
+	}
+	b.WriteString("</table>")
+	return htmltemplate.HTML(b.String())
+}
+
+// levelColor return green for OK, otherwise red.
+func levelColor(level string) string {
+	if level == "OK" {
+		return "green"
+	}
+	return "red"
+}
+
+func graphLink(notifyData models.NotifyData) string {
+	if GraphLink == nil {
+		return ""
+	}
+	return GraphLink(notifyData)
+}
+
+// link return the base url with the query params of key/value pairs.
+func link(base string, kv ...string) string {
+	params := url.Values{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		params.Add(kv[i], kv[i+1])
+	}
+	if len(params) == 0 {
+		return base
+	}
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + params.Encode()
+}
@@ -0,0 +1,142 @@
+// Package tmpl render the notify content by templates.
+package tmpl
+
+import (
+	"bytes"
+	"container/list"
+	htmltemplate "html/template"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+)
+
+// The channel template name defined in alarm message.
+// The message can define per-channel variants by {{define "sms"}}...{{end}},
+// the whole message is used if the channel variant is not defined.
+const (
+	SMS         = "sms"
+	Wechat      = "wechat"
+	WechatTitle = "wechat_title"
+	Mail        = "mail"
+	MailSubject = "mail_subject"
+)
+
+// executor is the parsed text or html template.
+type executor interface {
+	Name() string
+	Lookup(name string) bool
+	Execute(name string, data interface{}) (string, error)
+}
+
+type textExecutor struct{ t *template.Template }
+
+func (e textExecutor) Name() string { return e.t.Name() }
+
+func (e textExecutor) Lookup(name string) bool { return e.t.Lookup(name) != nil }
+
+func (e textExecutor) Execute(name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	err := e.t.ExecuteTemplate(&buf, name, data)
+	return buf.String(), err
+}
+
+type htmlExecutor struct{ t *htmltemplate.Template }
+
+func (e htmlExecutor) Name() string { return e.t.Name() }
+
+func (e htmlExecutor) Lookup(name string) bool { return e.t.Lookup(name) != nil }
+
+func (e htmlExecutor) Execute(name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	err := e.t.ExecuteTemplate(&buf, name, data)
+	return buf.String(), err
+}
+
+// maxMessages is the max number of the parsed alarm messages cached.
+const maxMessages = 1000
+
+var (
+	// messages cache the parsed alarm message, key is html flag + message.
+	// The least recently used message is evicted if the cache is full.
+	messages    = make(map[string]*list.Element)
+	messagesLRU = list.New()
+	messagesMu  sync.Mutex
+)
+
+type messageEntry struct {
+	key string
+	e   executor
+}
+
+// parseMessage parse the alarm message, the mail content is parsed as html template
+// to escape the notify data.
+func parseMessage(message string, html bool) (executor, error) {
+	key := "t" + message
+	if html {
+		key = "h" + message
+	}
+	messagesMu.Lock()
+	defer messagesMu.Unlock()
+	if elem, ok := messages[key]; ok {
+		messagesLRU.MoveToFront(elem)
+		return elem.Value.(*messageEntry).e, nil
+	}
+
+	var e executor
+	if html {
+		t, err := htmltemplate.New("message").Funcs(htmltemplate.FuncMap(funcs)).Parse(message)
+		if err != nil {
+			return nil, err
+		}
+		e = htmlExecutor{t}
+	} else {
+		t, err := template.New("message").Funcs(funcs).Parse(message)
+		if err != nil {
+			return nil, err
+		}
+		e = textExecutor{t}
+	}
+	messages[key] = messagesLRU.PushFront(&messageEntry{key: key, e: e})
+	if messagesLRU.Len() > maxMessages {
+		oldest := messagesLRU.Back()
+		messagesLRU.Remove(oldest)
+		delete(messages, oldest.Value.(*messageEntry).key)
+	}
+	return e, nil
+}
+
+// Message render the alarm message of notify data for the channel template name.
+// Return ok is false if the alarm has no message or render fail,
+// the caller should use the default layout then.
+func Message(name string, notifyData models.NotifyData) (string, bool) {
+	if notifyData.Message == "" || notifyData.Msg != "" || len(notifyData.Digest) != 0 {
+		return "", false
+	}
+	e, err := parseMessage(notifyData.Message, name == Mail)
+	if err != nil {
+		log.Errorf("parse message of alarm %s fail, use default layout: %s", notifyData.AlarmName, err.Error())
+		return "", false
+	}
+
+	tmplName := name
+	if !e.Lookup(name) {
+		switch name {
+		case WechatTitle, MailSubject:
+			// the title/subject use default layout if not defined.
+			return "", false
+		}
+		tmplName = "message"
+	}
+	output, err := e.Execute(tmplName, notifyData)
+	if err != nil {
+		log.Errorf("render %s message of alarm %s fail, use default layout: %s", name, notifyData.AlarmName, err.Error())
+		return "", false
+	}
+	if output = strings.TrimSpace(output); output == "" {
+		return "", false
+	}
+	return output, true
+}
@@ -0,0 +1,222 @@
+package tmpl
+
+import (
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+)
+
+// The kind of notify, every channel has one template file per kind
+// named as <channel>.<kind>.tmpl in the template dir,
+// the localized file <channel>.<kind>.<locale>.tmpl is preferred if exist.
+// The mail subject and wechat title is the "subject" template defined in the file.
+const (
+	KindProblem  = "problem"
+	KindRecovery = "recovery"
+	KindAdhoc    = "adhoc"
+	KindDigest   = "digest"
+
+	subjectName     = "subject"
+	fileExt         = ".tmpl"
+	defaultInterval = 10 // unit: second
+)
+
+// Kinds is all kinds of notify.
+var Kinds = []string{KindProblem, KindRecovery, KindAdhoc, KindDigest}
+
+// Kind return the kind of the notify data.
+func Kind(notifyData models.NotifyData) string {
+	switch {
+	case notifyData.Msg != "":
+		return KindAdhoc
+	case len(notifyData.Digest) != 0:
+		return KindDigest
+	case notifyData.Level == "OK":
+		return KindRecovery
+	default:
+		return KindProblem
+	}
+}
+
+// store keep the templates parsed from template dir.
+type store struct {
+	mu        sync.RWMutex
+	templates map[string]executor // key: <channel>.<kind>[.<locale>]
+	modTimes  map[string]time.Time
+}
+
+var files = &store{templates: make(map[string]executor), modTimes: make(map[string]time.Time)}
+
+// parseFile parse the template file, the mail template is parsed as html template.
+func parseFile(channel, path string) (executor, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	if channel == Mail {
+		t, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(funcs)).Parse(string(b))
+		if err != nil {
+			return nil, err
+		}
+		return htmlExecutor{t}, nil
+	}
+	t, err := template.New(name).Funcs(funcs).Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+	return textExecutor{t}, nil
+}
+
+// Load read the changed template files from the template dir.
+// The previous template is kept if the changed file parse fail.
+func Load() error {
+	dir := config.GetConfig().Template.Dir
+	if dir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+fileExt))
+	if err != nil {
+		return err
+	}
+
+	files.mu.Lock()
+	defer files.mu.Unlock()
+	exist := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		key := strings.TrimSuffix(filepath.Base(path), fileExt)
+		split := strings.SplitN(key, ".", 2)
+		if len(split) != 2 {
+			log.Warningf("template file %s is not named as <channel>.<kind>%s, skip it", path, fileExt)
+			continue
+		}
+		exist[key] = true
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Errorf("stat template file %s fail: %s", path, err.Error())
+			continue
+		}
+		if modTime, ok := files.modTimes[key]; ok && modTime.Equal(info.ModTime()) {
+			continue
+		}
+		e, err := parseFile(split[0], path)
+		if err != nil {
+			log.Errorf("parse template file %s fail, keep the previous: %s", path, err.Error())
+			continue
+		}
+		log.Infof("load template file %s", path)
+		files.templates[key], files.modTimes[key] = e, info.ModTime()
+	}
+	for key := range files.templates {
+		if !exist[key] {
+			log.Infof("template %s is removed", key)
+			delete(files.templates, key)
+			delete(files.modTimes, key)
+		}
+	}
+	return nil
+}
+
+// ReloadLoop reload the template files on change periodically until ctx is done.
+func ReloadLoop(ctx context.Context) {
+	for {
+		if err := Load(); err != nil {
+			log.Errorf("load templates fail: %s", err.Error())
+		}
+		interval := config.GetConfig().Template.Interval
+		if interval < 1 {
+			interval = defaultInterval
+		}
+		select {
+		case <-time.After(time.Duration(interval) * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// render the template file of channel and kind, name is empty to render the main template.
+func (s *store) render(channel, kind, name string, notifyData models.NotifyData) (string, bool) {
+	s.mu.RLock()
+	e, ok := s.templates[channel+"."+kind+"."+notifyData.Locale]
+	if !ok {
+		e, ok = s.templates[channel+"."+kind]
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	if name == "" {
+		name = e.Name()
+	} else if !e.Lookup(name) {
+		return "", false
+	}
+	output, err := e.Execute(name, notifyData)
+	if err != nil {
+		log.Errorf("render template %s.%s fail, use default layout: %s", channel, kind, err.Error())
+		return "", false
+	}
+	if output = strings.TrimSpace(output); output == "" {
+		return "", false
+	}
+	return output, true
+}
+
+// Content return the notify content of the channel.
+// The alarm message is preferred, then the template file of the channel and kind.
+// Return ok is false if none of them can render, the caller should use the default layout then.
+func Content(channel string, notifyData models.NotifyData) (string, bool) {
+	if output, ok := Message(channel, notifyData); ok {
+		return output, true
+	}
+	return files.render(channel, Kind(notifyData), "", notifyData)
+}
+
+// Subject return the mail subject or wechat title.
+func Subject(channel string, notifyData models.NotifyData) (string, bool) {
+	name := MailSubject
+	if channel == Wechat {
+		name = WechatTitle
+	}
+	if output, ok := Message(name, notifyData); ok {
+		return output, true
+	}
+	return files.render(channel, Kind(notifyData), subjectName, notifyData)
+}
+
+// Sample return a sample notify data of the kind to preview the templates.
+func Sample(kind string) models.NotifyData {
+	now := time.Now()
+	notifyData := models.NewAlertMsg("web.product.loda", "web-01.loda", "10.0.0.1", "cpu.idle", "CRIT",
+		"cpu idle too low", "< 10", []string{"alice", "bob"}, map[string]string{"host": "web-01.loda", "cpu": "cpu-total"},
+		5.12, now)
+	notifyData.Duration = 17 * time.Minute
+	switch kind {
+	case KindRecovery:
+		notifyData.Level, notifyData.Value = "OK", 63.5
+		notifyData.Ack = &models.Ack{User: "alice", Time: now.Add(-10 * time.Minute), Note: "looking"}
+	case KindAdhoc:
+		notifyData.AlarmName, notifyData.Msg = "deploy web.product.loda", "deploy v1.2.3 to web.product.loda done"
+	case KindDigest:
+		for i := 1; i <= 3; i++ {
+			item := notifyData
+			item.Host = fmt.Sprintf("web-%02d.loda", i)
+			item.Tags = map[string]string{"host": item.Host, "cpu": "cpu-total"}
+			item.Value = float64(i * 3)
+			notifyData.Digest = append(notifyData.Digest, item)
+		}
+		notifyData.Host = ""
+	}
+	return notifyData
+}
@@ -0,0 +1,222 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+)
+
+const (
+	timeFormat = "2006-01-02 15:04:05"
+
+	// SignatureHeader keep the hex HMAC-SHA256 of the timestamp and body, signed by the webhook secret.
+	// The receiver should verify the signature of TimestampHeader + "." + body, and reject the
+	// request if the timestamp is too far from now(such as 5 minutes) to prevent replay.
+	SignatureHeader = "X-Event-Signature"
+	// TimestampHeader keep the unix time the payload is sent, it is signed with the body.
+	TimestampHeader = "X-Event-Timestamp"
+
+	defaultTimeout = 5   // unit: second
+	defaultBackoff = 500 // unit: millisecond
+	defaultRetry   = 3
+	maxDeliveries  = 200
+)
+
+// Payload is the json body posted to the webhook.
+type Payload struct {
+	Ns          string            `json:"ns"`
+	AlarmName   string            `json:"alarm"`
+	Host        string            `json:"host"`
+	IP          string            `json:"ip"`
+	Measurement string            `json:"measurement"`
+	Level       string            `json:"level"`
+	Expression  string            `json:"expression"`
+	Tags        map[string]string `json:"tags"`
+	Value       float64           `json:"value"`
+	Time        string            `json:"time"`
+	Receivers   []string          `json:"receivers"`
+	Msg         string            `json:"msg,omitempty"`
+	Ack         *models.Ack       `json:"ack,omitempty"`
+}
+
+// Delivery is the outcome of posting a payload to one webhook.
+type Delivery struct {
+	URL      string    `json:"url"`
+	Ns       string    `json:"ns"`
+	Alarm    string    `json:"alarm"`
+	Host     string    `json:"host"`
+	Level    string    `json:"level"`
+	Attempts int       `json:"attempts"`
+	Status   int       `json:"status"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+var (
+	deliveries  []Delivery
+	deliveryMu  sync.RWMutex
+	deliveryPos int
+)
+
+// Deliveries return the latest delivery outcomes, newest first.
+func Deliveries() []Delivery {
+	deliveryMu.RLock()
+	defer deliveryMu.RUnlock()
+	output := make([]Delivery, 0, len(deliveries))
+	for i := 1; i <= len(deliveries); i++ {
+		output = append(output, deliveries[(deliveryPos-i+len(deliveries))%len(deliveries)])
+	}
+	return output
+}
+
+func recordDelivery(d Delivery) {
+	deliveryMu.Lock()
+	defer deliveryMu.Unlock()
+	if len(deliveries) < maxDeliveries {
+		deliveries = append(deliveries, d)
+		deliveryPos = len(deliveries) % maxDeliveries
+		return
+	}
+	deliveries[deliveryPos] = d
+	deliveryPos = (deliveryPos + 1) % maxDeliveries
+}
+
+// SendWebhook post the notify data to every webhook of the alarm, the post is canceled if ctx is done.
+func SendWebhook(ctx context.Context, notifyData models.NotifyData) error {
+	if len(notifyData.WebHooks) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(newPayload(notifyData))
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, url := range notifyData.WebHooks {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		d := post(ctx, url, body)
+		d.Ns, d.Alarm, d.Host, d.Level = notifyData.Ns, notifyData.AlarmName, notifyData.Host, notifyData.Level
+		recordDelivery(d)
+		if !d.Success {
+			log.Errorf("post webhook %s fail after %d attempts: %s", url, d.Attempts, d.Error)
+			failed = append(failed, url)
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("post webhook fail: %s", strings.Join(failed, ","))
+	}
+	return nil
+}
+
+func newPayload(notifyData models.NotifyData) Payload {
+	return Payload{
+		Ns:          notifyData.Ns,
+		AlarmName:   notifyData.AlarmName,
+		Host:        notifyData.Host,
+		IP:          notifyData.IP,
+		Measurement: notifyData.Measurement,
+		Level:       notifyData.Level,
+		Expression:  notifyData.Expression,
+		Tags:        notifyData.Tags,
+		Value:       notifyData.Value,
+		Time:        notifyData.Time.Format(timeFormat),
+		Receivers:   notifyData.Receivers,
+		Msg:         notifyData.Msg,
+		Ack:         notifyData.Ack,
+	}
+}
+
+// Sign return the hex HMAC-SHA256 of timestamp + "." + body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// post send body to url, retry with exponential backoff
+// if the request fail or the webhook response 5xx/429.
+func post(ctx context.Context, url string, body []byte) Delivery {
+	conf := config.GetConfig().Webhook
+	timeout, backoff, retries := conf.Timeout, conf.Backoff, conf.Retry
+	if retries == 0 {
+		retries = defaultRetry
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	wait := time.Duration(backoff) * time.Millisecond
+
+	d := Delivery{URL: url}
+	for d.Attempts = 1; ; d.Attempts++ {
+		var retry bool
+		d.Status, retry, d.Error = postOnce(ctx, client, url, conf.Secret, body)
+		if d.Error == "" {
+			d.Success = true
+			break
+		}
+		if !retry || d.Attempts > retries {
+			break
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			d.Error = ctx.Err().Error()
+			d.Time = time.Now()
+			return d
+		}
+		wait *= 2
+	}
+	d.Time = time.Now()
+	return d
+}
+
+func postOnce(ctx context.Context, client *http.Client, url, secret string, body []byte) (status int, retry bool, errMsg string) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err.Error()
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	if secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(secret, timestamp, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, true, err.Error()
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode > 299 {
+		retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return resp.StatusCode, retry, fmt.Sprintf("response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, false, ""
+}
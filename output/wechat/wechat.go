@@ -1,31 +1,29 @@
 package wechat
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/metrics"
 	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/output/i18n"
 	"github.com/lodastack/event/output/mail"
+	"github.com/lodastack/event/output/tmpl"
 	"github.com/lodastack/log"
 )
 
 const (
 	timeFormat = "2006-01-02 15:04:05"
-
-	multi = "convergence"
 )
 
-func SendWechat(notifyData models.NotifyData) error {
-	var title string
-	if notifyData.Msg == "" {
-		title = fmt.Sprintf("报警:%s  %s", notifyData.AlarmName, notifyData.Level)
-	}
-
-	content := genWechatContent(notifyData)
+func SendWechat(ctx context.Context, notifyData models.NotifyData) error {
+	title, content := genWechatTitle(notifyData), genWechatContent(notifyData)
 
 	if len(notifyData.Receivers) == 0 {
 		log.Errorf("invalid Users: %v", notifyData.Receivers)
@@ -37,19 +35,48 @@ func SendWechat(notifyData models.NotifyData) error {
 		log.Errorf("not found send wechat script: %s", config.GetConfig().Wechat.Script)
 		return err
 	}
-	if out, err := exec.Command("/bin/bash", config.GetConfig().Wechat.Script, users, title, content, url.QueryEscape(mail.PngLink(notifyData))).Output(); err != nil {
+	defer metrics.OutputDuration.Since(time.Now(), "wechat_script")
+	if out, err := exec.CommandContext(ctx, "/bin/bash", config.GetConfig().Wechat.Script, users, title, content, url.QueryEscape(mail.PngLink(notifyData))).Output(); err != nil {
 		log.Errorf("run wechat script error: %s, output: %s", err.Error(), string(out))
+		return err
 	}
 	return nil
 }
 
+// Preview return the wechat title and content of the notify data.
+func Preview(notifyData models.NotifyData) (string, string) {
+	return genWechatTitle(notifyData), genWechatContent(notifyData)
+}
+
+func genWechatTitle(notifyData models.NotifyData) string {
+	if title, ok := tmpl.Subject(tmpl.Wechat, notifyData); ok {
+		return title
+	}
+	locale := notifyData.Locale
+	if len(notifyData.Digest) > 0 {
+		return fmt.Sprintf("%s %s:%s  %d", i18n.T(locale, i18n.KeyAlert), i18n.T(locale, i18n.KeyConvergence),
+			notifyData.AlarmName, len(notifyData.Digest))
+	}
+	if notifyData.Msg == "" {
+		return fmt.Sprintf("%s:%s  %s", i18n.T(locale, i18n.KeyAlert), notifyData.AlarmName, i18n.T(locale, notifyData.Level))
+	}
+	return ""
+}
+
 func genWechatContent(notifyData models.NotifyData) string {
+	if content, ok := tmpl.Content(tmpl.Wechat, notifyData); ok {
+		return content
+	}
 	if notifyData.Msg != "" {
 		return notifyData.Msg
 	}
+	locale := notifyData.Locale
+	if len(notifyData.Digest) > 0 {
+		return i18n.T(locale, i18n.KeyContent) + ":\n" + strings.Join(notifyData.DigestLines(timeFormat), "\n")
+	}
 	var ipDesc string
 	if notifyData.IP != "" {
-		ipDesc = "ip: " + notifyData.IP + "\n"
+		ipDesc = i18n.T(locale, i18n.KeyIP) + ": " + notifyData.IP + "\n"
 	}
 
 	var tagDescribe string
@@ -60,11 +87,16 @@ func genWechatContent(notifyData models.NotifyData) string {
 		tagDescribe = tagDescribe[:len(tagDescribe)-1]
 	}
 
-	return fmt.Sprintf("内容:\nmeasurement:  %s\nns: %s\n%s%s\nvalue: %.2f \ntime: %v",
-		notifyData.Measurement,
-		notifyData.Ns,
+	content := fmt.Sprintf("%s:\n%s:  %s\n%s: %s\n%s%s\n%s: %.2f \n%s: %v",
+		i18n.T(locale, i18n.KeyContent),
+		i18n.T(locale, i18n.KeyMeasurement), notifyData.Measurement,
+		i18n.T(locale, i18n.KeyNs), notifyData.Ns,
 		ipDesc,
 		tagDescribe,
-		notifyData.Value,
-		notifyData.Time.Format(timeFormat))
+		i18n.T(locale, i18n.KeyValue), notifyData.Value,
+		i18n.T(locale, i18n.KeyTime), notifyData.Time.Format(timeFormat))
+	if notifyData.Ack != nil {
+		content += "\n" + i18n.Ack(locale, notifyData.Ack)
+	}
+	return content
 }
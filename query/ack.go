@@ -0,0 +1,81 @@
+package query
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/work"
+
+	"github.com/lodastack/log"
+)
+
+// ackMsg is the body of ack request.
+type ackMsg struct {
+	Ns           string `json:"ns"`
+	AlarmVersion string `json:"alarmversion"`
+	Host         string `json:"host"`
+	TagString    string `json:"tagstring"`
+
+	User string `json:"user"`
+	Note string `json:"note"`
+}
+
+// @desc acknowledge the status to stop repeat notify, or remove the ack.
+// @router /ack [post,delete]
+func ackHandler(resp http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "POST":
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Errorf("Read body fail: %s.", err.Error())
+			errResp(resp, http.StatusInternalServerError, "read body fail")
+			return
+		}
+		var msg ackMsg
+		if err = json.Unmarshal(body, &msg); err != nil {
+			log.Errorf("Json unmarshal error: %s.", err.Error())
+			errResp(resp, http.StatusBadRequest, "parse json error")
+			return
+		}
+		if msg.Ns == "" || msg.AlarmVersion == "" || msg.TagString == "" || msg.User == "" {
+			errResp(resp, http.StatusBadRequest, "invalid param")
+			return
+		}
+
+		ack := models.Ack{User: msg.User, Note: msg.Note}
+		if err := worker.Status.SetAck(msg.Ns, msg.AlarmVersion, msg.Host, msg.TagString, ack); err == work.ErrNotAckable {
+			errResp(resp, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			log.Errorf("ack ns %s alarm %s host %s error: %s.", msg.Ns, msg.AlarmVersion, msg.Host, err.Error())
+			errResp(resp, http.StatusInternalServerError, "ack status error")
+			return
+		}
+		succResp(resp, 200, "OK", nil)
+
+	case "DELETE":
+		params, err := url.ParseQuery(req.URL.RawQuery)
+		if err != nil {
+			log.Error("parse url error:", err.Error())
+			errResp(resp, http.StatusInternalServerError, "parse url error")
+			return
+		}
+		ns, alarmVersion, host, tagString := params.Get("ns"), params.Get("alarmversion"), params.Get("host"), params.Get("tagString")
+		if ns == "" || alarmVersion == "" || tagString == "" {
+			errResp(resp, http.StatusBadRequest, "invalid param")
+			return
+		}
+		if err := worker.Status.ClearAck(ns, alarmVersion, host, tagString); err != nil {
+			log.Errorf("clear ack of ns %s alarm %s host %s error: %s.", ns, alarmVersion, host, err.Error())
+			errResp(resp, http.StatusInternalServerError, "clear ack error")
+			return
+		}
+		succResp(resp, 200, "OK", nil)
+
+	default:
+		errResp(resp, http.StatusMethodNotAllowed, "POST or DELETE please!")
+	}
+}
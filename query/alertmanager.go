@@ -0,0 +1,90 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/lodastack/event/loda"
+	"github.com/lodastack/event/metrics"
+	"github.com/lodastack/event/models"
+
+	"github.com/lodastack/log"
+)
+
+// alertResult is the handle result of one alertmanager alert.
+type alertResult struct {
+	Fingerprint string `json:"fingerprint"`
+	Ns          string `json:"ns"`
+	Version     string `json:"version"`
+	Host        string `json:"host"`
+	Error       string `json:"error,omitempty"`
+
+	// retry is true if the alert fail to dispatch, the batch should be sent again.
+	retry bool
+}
+
+// @desc receive the alertmanager webhook and handle every alert as event.
+// @router /alertmanager [post]
+func alertmanagerHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		errResp(resp, http.StatusMethodNotAllowed, "POST please!")
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		log.Errorf("Read body fail: %s.", err.Error())
+		errResp(resp, http.StatusInternalServerError, "read body fail")
+		return
+	}
+
+	var msg models.AlertmanagerMsg
+	if err = json.Unmarshal(body, &msg); err != nil {
+		log.Errorf("Json unmarshal error: %s.", err.Error())
+		errResp(resp, http.StatusBadRequest, "parse json error")
+		return
+	}
+
+	// NOTE: alertmanager retry the whole group if response is not 2xx,
+	// response 500 if any alert fail to dispatch so it is sent again, the handled alerts are deduplicated.
+	// The alert can not be identified is only reported, it fails again when resent.
+	results := make([]alertResult, len(msg.Alerts))
+	retry := false
+	for i, a := range msg.Alerts {
+		metrics.EventsReceived.Inc("alertmanager", a.Level().String())
+		results[i] = handleAlertmanagerAlert(a)
+		retry = retry || results[i].retry
+	}
+	if !retry {
+		succResp(resp, 200, "OK", results)
+		return
+	}
+	bytes, _ := json.Marshal(&Response{StatusCode: http.StatusInternalServerError, Msg: "dispatch alert fail", Data: results})
+	resp.Header().Add("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusInternalServerError)
+	resp.Write(bytes)
+}
+
+// handleAlertmanagerAlert read the ns/alarm identity of the alert and handle it.
+func handleAlertmanagerAlert(a models.AlertmanagerAlert) alertResult {
+	result := alertResult{Fingerprint: a.Fingerprint, Ns: a.Ns(), Version: a.Version(), Host: a.Host()}
+	if result.Ns == "" {
+		result.Error = "alert has no ns label"
+		return result
+	}
+	if result.Version == "" {
+		version, ok := loda.AlarmVersionByName(result.Ns, a.Name())
+		if !ok {
+			result.Error = fmt.Sprintf("not found alarm %s of ns %s", a.Name(), result.Ns)
+			return result
+		}
+		result.Version = version
+	}
+
+	if _, err := dispatchEvent(result.Ns, result.Version, a.EventData()); err != nil {
+		log.Errorf("Work handle alertmanager alert %s error: %s.", a.Fingerprint, err.Error())
+		result.Error, result.retry = err.Error(), true
+	}
+	return result
+}
@@ -0,0 +1,21 @@
+package query
+
+import (
+	"net/http"
+
+	"github.com/lodastack/event/config"
+)
+
+// @desc reload the config file, the current config is kept if the new config is invalid.
+// @router /config/reload [post]
+func configReloadHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		errResp(resp, http.StatusMethodNotAllowed, "POST please!")
+		return
+	}
+	if err := config.Reload(); err != nil {
+		errResp(resp, http.StatusBadRequest, err.Error())
+		return
+	}
+	succResp(resp, 200, "OK", nil)
+}
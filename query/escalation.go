@@ -0,0 +1,77 @@
+package query
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/work"
+
+	"github.com/lodastack/log"
+)
+
+// @desc list/get escalation policies, create/update or remove escalation policy.
+// @router /escalation [get,post,put,delete]
+func escalationHandler(resp http.ResponseWriter, req *http.Request) {
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		log.Error("parse url error:", err.Error())
+		errResp(resp, http.StatusInternalServerError, "parse url error")
+		return
+	}
+	name := params.Get("name")
+
+	switch req.Method {
+	case "GET":
+		if name == "" {
+			succResp(resp, 200, "OK", worker.Escalation.List())
+			return
+		}
+		policy, err := worker.Escalation.Get(name)
+		if err != nil {
+			errResp(resp, http.StatusNotFound, err.Error())
+			return
+		}
+		succResp(resp, 200, "OK", policy)
+
+	case "POST", "PUT":
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Errorf("Read body fail: %s.", err.Error())
+			errResp(resp, http.StatusInternalServerError, "read body fail")
+			return
+		}
+		var policy models.EscalationPolicy
+		if err = json.Unmarshal(body, &policy); err != nil {
+			log.Errorf("Json unmarshal error: %s.", err.Error())
+			errResp(resp, http.StatusBadRequest, "parse json error")
+			return
+		}
+		if policy, err = worker.Escalation.Set(policy); err != nil {
+			log.Errorf("set escalation error: %s.", err.Error())
+			errResp(resp, http.StatusBadRequest, err.Error())
+			return
+		}
+		succResp(resp, 200, "OK", policy)
+
+	case "DELETE":
+		if name == "" {
+			errResp(resp, http.StatusBadRequest, "invalid param")
+			return
+		}
+		if err := worker.Escalation.Remove(name); err == work.ErrEscalationNotFound {
+			errResp(resp, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			log.Errorf("remove escalation %s error: %s.", name, err.Error())
+			errResp(resp, http.StatusInternalServerError, "remove escalation error")
+			return
+		}
+		succResp(resp, 200, "OK", nil)
+
+	default:
+		errResp(resp, http.StatusMethodNotAllowed, "GET, POST, PUT or DELETE please!")
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"strings"
 
 	"github.com/lodastack/event/loda"
+	"github.com/lodastack/event/metrics"
 	"github.com/lodastack/event/models"
 	o "github.com/lodastack/event/output"
+	"github.com/lodastack/event/output/webhook"
+	"github.com/lodastack/event/work"
 	m "github.com/lodastack/models"
 
 	"github.com/lodastack/log"
@@ -53,11 +56,17 @@ func postDataHandler(resp http.ResponseWriter, req *http.Request) {
 	}
 
 	ns := versionSplit[0]
-	if err = worker.HandleEvent(ns, alarmversion, eventData); err != nil {
+	metrics.EventsReceived.Inc("post", eventData.Level.String())
+	queued, err := dispatchEvent(ns, alarmversion, eventData)
+	if err != nil {
 		log.Errorf("Work handle event error: %s.", err.Error())
 		errResp(resp, http.StatusInternalServerError, "handle event error")
 		return
 	}
+	if queued {
+		acceptResp(resp, "accepted", eventData)
+		return
+	}
 
 	// just return the origin influxdb rs
 	resp.Header().Add("Content-Type", "application/json")
@@ -97,6 +106,12 @@ func statusHandler(resp http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// @desc the revision and lag of the local status synced from cluster.
+// @router /status/cache [get]
+func statusCacheHandler(resp http.ResponseWriter, req *http.Request) {
+	succResp(resp, 200, "OK", worker.Status.CacheStats())
+}
+
 func clearStatusHandler(resp http.ResponseWriter, req *http.Request) {
 	params, err := url.ParseQuery(req.URL.RawQuery)
 	if err != nil {
@@ -139,21 +154,58 @@ func notifyHandler(resp http.ResponseWriter, req *http.Request) {
 	}
 
 	for _, _type := range nitofyMsg.Types {
-		handler, ok := o.Handlers[_type]
-		if !ok {
+		if _, ok := o.Handlers[_type]; !ok {
 			succResp(resp, 400, "type is invalid", nil)
 			return
 		}
+	}
 
-		go func(handler o.HandleFunc, receivers []string) {
-			if err := handler(models.NotifyData{
-				Msg:       nitofyMsg.Content,
-				AlarmName: nitofyMsg.Subject,
-				Receivers: receivers}); err != nil {
-				log.Error("output fail:", err.Error())
-			}
-		}(handler, loda.GetGroupUsers(nitofyMsg.Groups))
+	receivers := loda.GetGroupUsers(nitofyMsg.Groups)
+	for _, _type := range nitofyMsg.Types {
+		if err := o.Submit(_type, models.NotifyData{
+			Msg:       nitofyMsg.Content,
+			AlarmName: nitofyMsg.Subject,
+			Receivers: receivers}); err != nil {
+			log.Errorf("submit output %s fail: %s", _type, err.Error())
+			errResp(resp, http.StatusServiceUnavailable, "output is busy")
+			return
+		}
 	}
 
 	succResp(resp, 200, "OK", nil)
 }
+
+// @router /webhook/deliveries [get]
+func webhookDeliveriesHandler(resp http.ResponseWriter, req *http.Request) {
+	succResp(resp, 200, "OK", webhook.Deliveries())
+}
+
+// clusterInfo is the members and leader of the event cluster.
+type clusterInfo struct {
+	ID      string        `json:"id"`
+	Leader  string        `json:"leader"`
+	Members []work.Member `json:"members"`
+}
+
+// @desc the live members and the current leader of the event cluster.
+// @router /cluster [get]
+func clusterHandler(resp http.ResponseWriter, req *http.Request) {
+	leader, err := worker.Election.Leader()
+	if err != nil {
+		log.Errorf("read leader fail: %s", err.Error())
+		errResp(resp, http.StatusInternalServerError, "read leader fail")
+		return
+	}
+	members, err := worker.Election.Members()
+	if err != nil {
+		log.Errorf("read members fail: %s", err.Error())
+		errResp(resp, http.StatusInternalServerError, "read members fail")
+		return
+	}
+	succResp(resp, 200, "OK", clusterInfo{ID: worker.Election.ID(), Leader: leader, Members: members})
+}
+
+// @router /pool [get]
+func poolHandler(resp http.ResponseWriter, req *http.Request) {
+	succResp(resp, 200, "OK", o.PoolsStats())
+}
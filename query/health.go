@@ -0,0 +1,34 @@
+package query
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lodastack/event/work"
+)
+
+// @desc report the checks of dependencies, response 503 if any check fails.
+// @router /health [get]
+func healthHandler(resp http.ResponseWriter, req *http.Request) {
+	ok, checks := worker.Health()
+	checkResp(resp, ok, checks)
+}
+
+// @desc report the instance is ready to handle events or not, response 503 until the caches are warm.
+// @router /ready [get]
+func readyHandler(resp http.ResponseWriter, req *http.Request) {
+	ok, checks := worker.Ready()
+	checkResp(resp, ok, checks)
+}
+
+// checkResp response the checks, 200 if ok otherwise 503.
+func checkResp(resp http.ResponseWriter, ok bool, checks []work.Check) {
+	response := Response{StatusCode: http.StatusOK, Msg: "OK", Data: checks}
+	if !ok {
+		response.StatusCode, response.Msg = http.StatusServiceUnavailable, "check fail"
+	}
+	bytes, _ := json.Marshal(&response)
+	resp.Header().Add("Content-Type", "application/json")
+	resp.WriteHeader(response.StatusCode)
+	resp.Write(bytes)
+}
@@ -0,0 +1,78 @@
+package query
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lodastack/event/history"
+
+	"github.com/lodastack/log"
+)
+
+// @desc query the status transitions, newest first.
+// ns param match the ns and its child ns, tags param is as k1=v1,k2=v2,
+// start and end param is unix timestamp, unit: second.
+// @router /history [get]
+func historyHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		errResp(resp, http.StatusMethodNotAllowed, "GET please!")
+		return
+	}
+	if worker.History == nil {
+		errResp(resp, http.StatusServiceUnavailable, "history is not configured")
+		return
+	}
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		log.Error("parse url error:", err.Error())
+		errResp(resp, http.StatusInternalServerError, "parse url error")
+		return
+	}
+
+	q := history.Query{
+		Ns:           params.Get("ns"),
+		AlarmVersion: params.Get("alarmversion"),
+		Host:         params.Get("host"),
+		Level:        params.Get("level"),
+	}
+	if tags := params.Get("tags"); tags != "" {
+		q.Tags = make(map[string]string)
+		for _, tag := range strings.Split(tags, ",") {
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				errResp(resp, http.StatusBadRequest, "invalid tags: "+tags)
+				return
+			}
+			q.Tags[kv[0]] = kv[1]
+		}
+	}
+	for name, t := range map[string]*time.Time{"start": &q.Start, "end": &q.End} {
+		if v := params.Get(name); v != "" {
+			ts, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errResp(resp, http.StatusBadRequest, "invalid "+name+": "+v)
+				return
+			}
+			*t = time.Unix(ts, 0)
+		}
+	}
+	for name, n := range map[string]*int{"offset": &q.Offset, "limit": &q.Limit} {
+		if v := params.Get(name); v != "" {
+			if *n, err = strconv.Atoi(v); err != nil {
+				errResp(resp, http.StatusBadRequest, "invalid "+name+": "+v)
+				return
+			}
+		}
+	}
+
+	page, err := worker.History.Query(q)
+	if err != nil {
+		log.Errorf("query history fail: %s", err.Error())
+		errResp(resp, http.StatusInternalServerError, "query history fail")
+		return
+	}
+	succResp(resp, 200, "OK", page)
+}
@@ -1,8 +1,10 @@
 package query
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -48,6 +50,19 @@ func succResp(resp http.ResponseWriter, code int, msg string, data interface{})
 	resp.Write(bytes)
 }
 
+// acceptResp response 202 if the request is accepted but not handled yet.
+func acceptResp(resp http.ResponseWriter, msg string, data interface{}) {
+	response := Response{
+		StatusCode: http.StatusAccepted,
+		Msg:        msg,
+		Data:       data,
+	}
+	bytes, _ := json.Marshal(&response)
+	resp.Header().Add("Content-Type", "application/json")
+	resp.WriteHeader(response.StatusCode)
+	resp.Write(bytes)
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -80,6 +95,7 @@ func cors(inner http.Handler) http.Handler {
 				`Authorization`,
 				`Content-Length`,
 				`Content-Type`,
+				`Last-Event-ID`,
 				`X-CSRF-Token`,
 				`X-HTTP-Method-Override`,
 				`AuthToken`,
@@ -101,19 +117,91 @@ func addHandlers() {
 	prefix := "/event"
 
 	http.Handle(prefix+"/post", cors(http.HandlerFunc(postDataHandler)))
+	http.Handle(prefix+"/alertmanager", cors(http.HandlerFunc(alertmanagerHandler)))
 	http.Handle(prefix+"/output", cors(http.HandlerFunc(notifyHandler)))
 	http.Handle(prefix+"/status", cors(http.HandlerFunc(statusHandler)))
+	http.Handle(prefix+"/status/cache", cors(http.HandlerFunc(statusCacheHandler)))
 	http.Handle(prefix+"/clear/status", cors(http.HandlerFunc(clearStatusHandler)))
+	http.Handle(prefix+"/ack", cors(http.HandlerFunc(ackHandler)))
+	http.Handle(prefix+"/escalation", cors(http.HandlerFunc(escalationHandler)))
+	http.Handle(prefix+"/schedule", cors(http.HandlerFunc(scheduleHandler)))
+	http.Handle(prefix+"/oncall", cors(http.HandlerFunc(onCallHandler)))
+	http.Handle(prefix+"/silence", cors(http.HandlerFunc(silenceHandler)))
+	http.Handle(prefix+"/history", cors(http.HandlerFunc(historyHandler)))
+	http.Handle(prefix+"/stream", cors(http.HandlerFunc(streamHandler)))
+	http.Handle(prefix+"/cluster", cors(http.HandlerFunc(clusterHandler)))
+	http.Handle(prefix+"/pool", cors(http.HandlerFunc(poolHandler)))
+	http.Handle(prefix+"/queue", cors(http.HandlerFunc(queueHandler)))
+	http.Handle(prefix+"/webhook/deliveries", cors(http.HandlerFunc(webhookDeliveriesHandler)))
+	http.Handle(prefix+"/template/preview", cors(http.HandlerFunc(templatePreviewHandler)))
+	http.Handle(prefix+"/config/reload", cors(http.HandlerFunc(configReloadHandler)))
+
+	// the metrics, health and ready paths are at root as convention of prometheus and load balancer.
+	http.Handle("/metrics", http.HandlerFunc(metricsHandler))
+	http.Handle("/health", http.HandlerFunc(healthHandler))
+	http.Handle("/ready", http.HandlerFunc(readyHandler))
 }
 
-func Start(work *work.Work) {
+var (
+	// server is the http server started by Start.
+	server *http.Server
+	// cancelRequests end the long-lived requests such as stream on shutdown.
+	cancelRequests context.CancelFunc
+)
+
+// Start init the event queue and serve the http api in background until Shutdown.
+// The requests are derived from ctx, the long-lived requests such as stream end on Shutdown or ctx is done.
+func Start(ctx context.Context, work *work.Work) {
 	bind := fmt.Sprintf("%s", config.GetConfig().Com.Listen)
 	log.Infof("http start on %s!\n", bind)
 	worker = work
+	if err := initQueue(); err != nil {
+		fmt.Fprintf(os.Stderr, "init event queue failed:\n%s\n", err.Error())
+		os.Exit(1)
+	}
 	addHandlers()
 
-	err := http.ListenAndServe(bind, nil)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "http start failed:\n%s\n", err.Error())
+	var reqCtx context.Context
+	reqCtx, cancelRequests = context.WithCancel(ctx)
+	server = &http.Server{
+		Addr:        bind,
+		BaseContext: func(net.Listener) context.Context { return reqCtx },
+	}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			fmt.Fprintf(os.Stderr, "http start failed:\n%s\n", err.Error())
+		}
+	}()
+}
+
+// Shutdown stop accepting events, wait the in-flight requests and the event queue consumers
+// finished until ctx is done. The queued events not handled are kept on disk.
+// Return false if the consumers are still running, the caller should not release what they use.
+func Shutdown(ctx context.Context) bool {
+	if server != nil {
+		cancelRequests()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Errorf("shutdown http server fail, abandon the in-flight requests: %s", err.Error())
+		}
+	}
+	if eventQueue == nil {
+		return true
+	}
+	stopped := make(chan struct{})
+	go func() {
+		eventQueue.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		log.Infof("event queue stopped, %d events kept", eventQueue.Stats().Depth)
+		if err := eventQueue.Close(); err != nil {
+			log.Errorf("close event queue fail: %s", err.Error())
+		}
+		return true
+	case <-ctx.Done():
+		log.Errorf("event queue consumers are not stopped on shutdown, abandon the events in handling")
+		return false
 	}
 }
@@ -0,0 +1,22 @@
+package query
+
+import (
+	"net/http"
+
+	"github.com/lodastack/event/metrics"
+
+	"github.com/lodastack/log"
+)
+
+// @desc expose the metrics of event in the prometheus text format.
+// @router /metrics [get]
+func metricsHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		errResp(resp, http.StatusMethodNotAllowed, "GET please!")
+		return
+	}
+	resp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.WriteTo(resp); err != nil {
+		log.Errorf("write metrics fail: %s", err.Error())
+	}
+}
@@ -0,0 +1,84 @@
+package query
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/queue"
+
+	"github.com/lodastack/log"
+)
+
+const (
+	defaultQueueWorkers     = 4
+	defaultQueueMaxAttempts = 5
+)
+
+// eventQueue keep the accepted events before handled, nil if not configured.
+var eventQueue *queue.Queue
+
+// queuedEvent is the event kept in eventQueue.
+type queuedEvent struct {
+	Ns        string           `json:"ns"`
+	Version   string           `json:"version"`
+	EventData models.EventData `json:"event"`
+}
+
+// initQueue open the event queue and start consumers if the queue path is configured.
+func initQueue() error {
+	conf := config.GetConfig().Queue
+	if conf.Path == "" {
+		log.Info("event queue is not configured, handle event synchronously")
+		return nil
+	}
+	q, err := queue.Open(conf.Path)
+	if err != nil {
+		return err
+	}
+
+	workers, maxAttempts := conf.Workers, conf.MaxAttempts
+	if workers < 1 {
+		workers = defaultQueueWorkers
+	}
+	if maxAttempts < 1 {
+		maxAttempts = defaultQueueMaxAttempts
+	}
+	eventQueue = q
+	eventQueue.Consume(workers, maxAttempts, consumeEvent)
+	log.Infof("event queue %s start with %d workers, depth: %d", conf.Path, workers, q.Stats().Depth)
+	return nil
+}
+
+func consumeEvent(data []byte) error {
+	var e queuedEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		// the item is broken and will never be handled, drop it.
+		log.Errorf("unmarshal queued event fail, drop it: %s", err.Error())
+		return nil
+	}
+	return worker.HandleEvent(e.Ns, e.Version, e.EventData)
+}
+
+// dispatchEvent put the event to queue if configured, otherwise handle it synchronously.
+// Return queued is true if the event is durably enqueued.
+func dispatchEvent(ns, alarmVersion string, eventData models.EventData) (queued bool, err error) {
+	if eventQueue == nil {
+		return false, worker.HandleEvent(ns, alarmVersion, eventData)
+	}
+	data, err := json.Marshal(&queuedEvent{Ns: ns, Version: alarmVersion, EventData: eventData})
+	if err != nil {
+		return false, err
+	}
+	return true, eventQueue.Push(data)
+}
+
+// @router /queue [get]
+func queueHandler(resp http.ResponseWriter, req *http.Request) {
+	if eventQueue == nil {
+		errResp(resp, http.StatusNotFound, "event queue is not configured")
+		return
+	}
+	succResp(resp, 200, "OK", eventQueue.Stats())
+}
@@ -0,0 +1,174 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/work"
+
+	"github.com/lodastack/log"
+)
+
+const (
+	icalTimeFormat    = "20060102T150405Z"
+	defaultOnCallDays = 14
+	// maxOnCallDays limit the shifts generated for a request.
+	maxOnCallDays = 90
+)
+
+// @desc list/get on-call schedules, create/update or remove schedule.
+// @router /schedule [get,post,put,delete]
+func scheduleHandler(resp http.ResponseWriter, req *http.Request) {
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		log.Error("parse url error:", err.Error())
+		errResp(resp, http.StatusInternalServerError, "parse url error")
+		return
+	}
+	name := params.Get("name")
+
+	switch req.Method {
+	case "GET":
+		if name == "" {
+			succResp(resp, 200, "OK", worker.Schedule.List())
+			return
+		}
+		schedule, err := worker.Schedule.Get(name)
+		if err != nil {
+			errResp(resp, http.StatusNotFound, err.Error())
+			return
+		}
+		succResp(resp, 200, "OK", schedule)
+
+	case "POST", "PUT":
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Errorf("Read body fail: %s.", err.Error())
+			errResp(resp, http.StatusInternalServerError, "read body fail")
+			return
+		}
+		var schedule models.Schedule
+		if err = json.Unmarshal(body, &schedule); err != nil {
+			log.Errorf("Json unmarshal error: %s.", err.Error())
+			errResp(resp, http.StatusBadRequest, "parse json error")
+			return
+		}
+		if schedule, err = worker.Schedule.Set(schedule); err != nil {
+			log.Errorf("set schedule error: %s.", err.Error())
+			errResp(resp, http.StatusBadRequest, err.Error())
+			return
+		}
+		succResp(resp, 200, "OK", schedule)
+
+	case "DELETE":
+		if name == "" {
+			errResp(resp, http.StatusBadRequest, "invalid param")
+			return
+		}
+		if err := worker.Schedule.Remove(name); err == work.ErrScheduleNotFound {
+			errResp(resp, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			log.Errorf("remove schedule %s error: %s.", name, err.Error())
+			errResp(resp, http.StatusInternalServerError, "remove schedule error")
+			return
+		}
+		succResp(resp, 200, "OK", nil)
+
+	default:
+		errResp(resp, http.StatusMethodNotAllowed, "GET, POST, PUT or DELETE please!")
+	}
+}
+
+// onCall is who is on call of a schedule.
+type onCall struct {
+	Schedule string         `json:"schedule"`
+	Groups   []string       `json:"groups"`
+	Users    []string       `json:"users"`
+	Shifts   []models.Shift `json:"shifts"`
+}
+
+// @desc show who is on call, export the shifts as iCal if format is ical.
+// @router /oncall [get]
+func onCallHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		errResp(resp, http.StatusMethodNotAllowed, "GET please!")
+		return
+	}
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		log.Error("parse url error:", err.Error())
+		errResp(resp, http.StatusInternalServerError, "parse url error")
+		return
+	}
+
+	at := time.Now()
+	if ts, err := strconv.ParseInt(params.Get("time"), 10, 64); err == nil {
+		at = time.Unix(ts, 0)
+	}
+	days, err := strconv.Atoi(params.Get("days"))
+	if err != nil || days < 1 {
+		days = defaultOnCallDays
+	}
+	if days > maxOnCallDays {
+		errResp(resp, http.StatusBadRequest, fmt.Sprintf("days should not be more than %d", maxOnCallDays))
+		return
+	}
+
+	var schedules []models.Schedule
+	if name := params.Get("schedule"); name != "" {
+		schedule, err := worker.Schedule.Get(name)
+		if err != nil {
+			errResp(resp, http.StatusNotFound, err.Error())
+			return
+		}
+		schedules = []models.Schedule{schedule}
+	} else {
+		schedules = worker.Schedule.List()
+	}
+
+	output := make([]onCall, len(schedules))
+	for i, schedule := range schedules {
+		output[i] = onCall{
+			Schedule: schedule.Name,
+			Groups:   schedule.Groups,
+			Users:    schedule.OnCall(at),
+			Shifts:   schedule.Shifts(at, at.AddDate(0, 0, days)),
+		}
+	}
+
+	if params.Get("format") == "ical" {
+		resp.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		resp.Header().Set("Content-Disposition", "attachment; filename=oncall.ics")
+		resp.WriteHeader(http.StatusOK)
+		resp.Write(genICal(output))
+		return
+	}
+	succResp(resp, 200, "OK", output)
+}
+
+// genICal return the shifts as iCalendar(RFC 5545).
+func genICal(onCalls []onCall) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//lodastack//event oncall//EN\r\nCALSCALE:GREGORIAN\r\n")
+	now := time.Now().UTC().Format(icalTimeFormat)
+	for _, oc := range onCalls {
+		for _, shift := range oc.Shifts {
+			start, end := shift.Start.UTC().Format(icalTimeFormat), shift.End.UTC().Format(icalTimeFormat)
+			buf.WriteString("BEGIN:VEVENT\r\n")
+			fmt.Fprintf(&buf, "UID:%s-%s-%s-%s@event\r\n", oc.Schedule, shift.Layer, shift.User, start)
+			fmt.Fprintf(&buf, "DTSTAMP:%s\r\nDTSTART:%s\r\nDTEND:%s\r\n", now, start, end)
+			fmt.Fprintf(&buf, "SUMMARY:%s on call (%s/%s)\r\n", shift.User, oc.Schedule, shift.Layer)
+			buf.WriteString("END:VEVENT\r\n")
+		}
+	}
+	buf.WriteString("END:VCALENDAR\r\n")
+	return buf.Bytes()
+}
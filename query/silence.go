@@ -0,0 +1,86 @@
+package query
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/work"
+
+	"github.com/lodastack/log"
+)
+
+// @desc list/get silences, create/update silence or remove silence.
+// @router /silence [get,post,put,delete]
+func silenceHandler(resp http.ResponseWriter, req *http.Request) {
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		log.Error("parse url error:", err.Error())
+		errResp(resp, http.StatusInternalServerError, "parse url error")
+		return
+	}
+	id := params.Get("id")
+
+	switch req.Method {
+	case "GET":
+		if id == "" {
+			succResp(resp, 200, "OK", worker.Silence.List(params.Get("active") == "true"))
+			return
+		}
+		silence, err := worker.Silence.Get(id)
+		if err != nil {
+			errResp(resp, http.StatusNotFound, err.Error())
+			return
+		}
+		succResp(resp, 200, "OK", silence)
+
+	case "POST", "PUT":
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Errorf("Read body fail: %s.", err.Error())
+			errResp(resp, http.StatusInternalServerError, "read body fail")
+			return
+		}
+		var silence models.Silence
+		if err = json.Unmarshal(body, &silence); err != nil {
+			log.Errorf("Json unmarshal error: %s.", err.Error())
+			errResp(resp, http.StatusBadRequest, "parse json error")
+			return
+		}
+		if req.Method == "POST" {
+			silence.ID = ""
+		} else if id != "" {
+			silence.ID = id
+		}
+		silence, err = worker.Silence.Set(silence)
+		if err == work.ErrSilenceNotFound {
+			errResp(resp, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			log.Errorf("set silence error: %s.", err.Error())
+			errResp(resp, http.StatusBadRequest, err.Error())
+			return
+		}
+		succResp(resp, 200, "OK", silence)
+
+	case "DELETE":
+		if id == "" {
+			errResp(resp, http.StatusBadRequest, "invalid param")
+			return
+		}
+		if err := worker.Silence.Remove(id); err == work.ErrSilenceNotFound {
+			errResp(resp, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			log.Errorf("remove silence %s error: %s.", id, err.Error())
+			errResp(resp, http.StatusInternalServerError, "remove silence error")
+			return
+		}
+		succResp(resp, 200, "OK", nil)
+
+	default:
+		errResp(resp, http.StatusMethodNotAllowed, "GET, POST, PUT or DELETE please!")
+	}
+}
@@ -0,0 +1,111 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lodastack/event/stream"
+
+	"github.com/lodastack/log"
+)
+
+// keepAliveInterval is the interval to send comment line to keep the idle stream alive.
+const keepAliveInterval = 15 * time.Second
+
+// @desc stream the status transitions as server-sent events.
+// ns param match the ns and its child ns, level and alarmversion param filter the events.
+// Resume from the event ID by Last-Event-ID header or since param,
+// a "reset" event is sent first if some events after the ID are lost, the client should reload the status.
+// A "lagged" event is sent and the stream is closed if the client is too slow to receive.
+// @router /stream [get]
+func streamHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		errResp(resp, http.StatusMethodNotAllowed, "GET please!")
+		return
+	}
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		errResp(resp, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		log.Error("parse url error:", err.Error())
+		errResp(resp, http.StatusInternalServerError, "parse url error")
+		return
+	}
+
+	cursor := req.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = params.Get("since")
+	}
+	var after uint64
+	if cursor != "" {
+		if after, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			errResp(resp, http.StatusBadRequest, "invalid event id")
+			return
+		}
+	}
+
+	sub, replay, missed := stream.Subscribe(stream.Filter{
+		Ns:           params.Get("ns"),
+		AlarmVersion: params.Get("alarmversion"),
+		Level:        params.Get("level"),
+	}, after)
+	defer stream.Unsubscribe(sub)
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+
+	if missed {
+		fmt.Fprint(resp, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range replay {
+		if err := writeStreamEvent(resp, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(resp, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				if sub.Lagged() {
+					log.Warningf("stream subscriber %s lagged, close it", req.RemoteAddr)
+					fmt.Fprint(resp, "event: lagged\ndata: {}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			if err := writeStreamEvent(resp, e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeStreamEvent(resp http.ResponseWriter, e stream.Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("marshal stream event %d fail: %s", e.ID, err.Error())
+		return nil
+	}
+	_, err = fmt.Fprintf(resp, "id: %d\ndata: %s\n\n", e.ID, b)
+	return err
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/lodastack/event/common"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/output"
+	"github.com/lodastack/event/output/i18n"
+	"github.com/lodastack/event/output/tmpl"
+
+	"github.com/lodastack/log"
+)
+
+// preview is the notify rendered by the channel template.
+type preview struct {
+	Channel string `json:"channel"`
+	Kind    string `json:"kind"`
+	Locale  string `json:"locale"`
+	Subject string `json:"subject"`
+	Content string `json:"content"`
+}
+
+// @desc render the sample notify data of kind by the channel template,
+// POST the notify data to render it instead of the sample,
+// message param is the alarm message template to preview,
+// locale param is the locale to render, use the locale of ns if empty.
+// @router /template/preview [get,post]
+func templatePreviewHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "POST" {
+		errResp(resp, http.StatusMethodNotAllowed, "GET or POST please!")
+		return
+	}
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		log.Error("parse url error:", err.Error())
+		errResp(resp, http.StatusInternalServerError, "parse url error")
+		return
+	}
+	channel, kind := params.Get("channel"), params.Get("kind")
+	if channel == "" {
+		channel = tmpl.Mail
+	}
+	if kind == "" {
+		kind = tmpl.KindProblem
+	}
+	if _, ok := common.ContainString(tmpl.Kinds, kind); !ok {
+		errResp(resp, http.StatusBadRequest, "invalid kind: "+kind)
+		return
+	}
+
+	notifyData := tmpl.Sample(kind)
+	if req.Method == "POST" {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Errorf("Read body fail: %s.", err.Error())
+			errResp(resp, http.StatusInternalServerError, "read body fail")
+			return
+		}
+		if len(body) != 0 {
+			notifyData = models.NotifyData{}
+			if err := json.Unmarshal(body, &notifyData); err != nil {
+				log.Errorf("Json unmarshal error: %s.", err.Error())
+				errResp(resp, http.StatusBadRequest, "parse json error")
+				return
+			}
+			kind = tmpl.Kind(notifyData)
+		}
+	}
+	if message := params.Get("message"); message != "" {
+		notifyData.Message = message
+	}
+	if locale := params.Get("locale"); locale != "" {
+		notifyData.Locale = locale
+	}
+	if notifyData.Locale == "" {
+		notifyData.Locale = i18n.Locale(channel, "", notifyData.Ns, nil)
+	}
+
+	subject, content, err := output.Preview(channel, notifyData)
+	if err != nil {
+		errResp(resp, http.StatusBadRequest, err.Error())
+		return
+	}
+	succResp(resp, 200, "OK", preview{Channel: channel, Kind: kind, Locale: notifyData.Locale, Subject: subject, Content: content})
+}
@@ -0,0 +1,280 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/lodastack/log"
+)
+
+var (
+	bucketName = []byte("queue")
+
+	// ErrEmpty is returned by Pop if has no item to consume.
+	ErrEmpty = errors.New("queue is empty")
+	// ErrRetryLater is returned by the consume fn to retry the item after the poll interval,
+	// such as the consumer has no room now. It is not logged or counted as an attempt.
+	ErrRetryLater = errors.New("retry later")
+
+	// pollInterval is the interval consumer check the queue if not notified.
+	pollInterval = time.Second
+)
+
+// Item is a leased item of the queue.
+type Item struct {
+	ID       uint64
+	Data     []byte
+	Time     time.Time
+	Attempts int
+}
+
+// Stats is the depth and age of the queue.
+type Stats struct {
+	Depth    int           `json:"depth"`
+	InFlight int           `json:"inflight"`
+	Age      time.Duration `json:"age"` // age of the oldest item, unit: nanosecond
+	AgeStr   string        `json:"agestr"`
+}
+
+// Queue is a persistent FIFO queue on boltdb.
+// The item is kept on disk until it is acked, so the item not acked
+// will be consumed again after restart(at-least-once).
+type Queue struct {
+	db *bolt.DB
+
+	mu       sync.Mutex
+	inflight map[uint64]bool
+	attempts map[uint64]int
+
+	notify chan struct{}
+
+	// done is closed to stop the consumers.
+	done      chan struct{}
+	stopOnce  sync.Once
+	consumers sync.WaitGroup
+}
+
+// Open open or create the queue at path.
+func Open(path string) (*Queue, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Queue{
+		db:       db,
+		inflight: make(map[uint64]bool),
+		attempts: make(map[uint64]int),
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Stop stop the consumers and wait the items in consuming finished.
+// The items not consumed are kept on disk.
+func (q *Queue) Stop() {
+	q.stopOnce.Do(func() { close(q.done) })
+	q.consumers.Wait()
+}
+
+// Close stop the consumers and close the queue db.
+func (q *Queue) Close() error {
+	q.Stop()
+	return q.db.Close()
+}
+
+// Push append data to the queue, the data is synced to disk when Push return.
+func (q *Queue) Push(data []byte) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(id), encodeValue(time.Now(), data))
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pop lease the oldest item which is not in flight.
+// The item must be Ack or Release after consumed.
+func (q *Queue) Pop() (Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var item Item
+	err := q.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketName).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			id := btoi(k)
+			if q.inflight[id] {
+				continue
+			}
+			item.ID = id
+			item.Time, item.Data = decodeValue(v)
+			return nil
+		}
+		return ErrEmpty
+	})
+	if err != nil {
+		return item, err
+	}
+	q.inflight[item.ID] = true
+	q.attempts[item.ID]++
+	item.Attempts = q.attempts[item.ID]
+	return item, nil
+}
+
+// Ack remove the item from the queue.
+func (q *Queue) Ack(id uint64) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Delete(itob(id))
+	})
+	q.mu.Lock()
+	delete(q.inflight, id)
+	delete(q.attempts, id)
+	q.mu.Unlock()
+	return err
+}
+
+// Release make the item can be leased again.
+func (q *Queue) Release(id uint64) {
+	q.mu.Lock()
+	delete(q.inflight, id)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Stats return the depth, in flight number and oldest item age of the queue.
+func (q *Queue) Stats() Stats {
+	var s Stats
+	q.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		s.Depth = b.Stats().KeyN
+		if _, v := b.Cursor().First(); v != nil {
+			t, _ := decodeValue(v)
+			s.Age = time.Since(t)
+		}
+		return nil
+	})
+	q.mu.Lock()
+	s.InFlight = len(q.inflight)
+	q.mu.Unlock()
+	s.AgeStr = s.Age.String()
+	return s
+}
+
+// Consume start workers to consume the queue by fn.
+// The item is acked if fn return nil, otherwise it will be retried until maxAttempts.
+// The item is retried after the poll interval if fn return ErrRetryLater.
+func (q *Queue) Consume(workers, maxAttempts int, fn func(data []byte) error) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		q.consumers.Add(1)
+		go q.consume(maxAttempts, fn)
+	}
+}
+
+func (q *Queue) consume(maxAttempts int, fn func(data []byte) error) {
+	defer q.consumers.Done()
+	for {
+		select {
+		case <-q.done:
+			return
+		default:
+		}
+		item, err := q.Pop()
+		if err != nil {
+			if err != ErrEmpty {
+				log.Errorf("pop queue fail: %s", err.Error())
+			}
+			select {
+			case <-q.notify:
+			case <-time.After(pollInterval):
+			case <-q.done:
+				return
+			}
+			continue
+		}
+
+		if err = fn(item.Data); err == ErrRetryLater {
+			q.mu.Lock()
+			q.attempts[item.ID]--
+			q.mu.Unlock()
+			select {
+			case <-time.After(pollInterval):
+			case <-q.done:
+			}
+			q.Release(item.ID)
+			continue
+		}
+		if err == nil || (maxAttempts > 0 && item.Attempts >= maxAttempts) {
+			if err != nil {
+				log.Errorf("consume queue item %d fail %d times, drop it: %s", item.ID, item.Attempts, err.Error())
+			}
+			if err := q.Ack(item.ID); err != nil {
+				log.Errorf("ack queue item %d fail: %s", item.ID, err.Error())
+			}
+			continue
+		}
+
+		log.Errorf("consume queue item %d fail, retry later: %s", item.ID, err.Error())
+		select {
+		case <-time.After(time.Duration(item.Attempts) * pollInterval):
+		case <-q.done:
+		}
+		q.Release(item.ID)
+	}
+}
+
+func encodeValue(t time.Time, data []byte) []byte {
+	v := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(v, uint64(t.UnixNano()))
+	copy(v[8:], data)
+	return v
+}
+
+func decodeValue(v []byte) (time.Time, []byte) {
+	if len(v) < 8 {
+		return time.Time{}, nil
+	}
+	data := make([]byte, len(v)-8)
+	copy(data, v[8:])
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v))), data
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func btoi(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
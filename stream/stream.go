@@ -0,0 +1,155 @@
+// Package stream broadcast the status transitions to the subscribers.
+package stream
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/models"
+)
+
+const (
+	// bufferSize is the number of recent events kept for the subscriber to resume.
+	bufferSize = 1000
+	// queueSize is the number of events pending on a subscriber,
+	// the subscriber is dropped as lagged if its queue is full.
+	queueSize = 256
+)
+
+// Event is a transition of status.
+type Event struct {
+	// ID is the cursor of the event, increase in order.
+	ID       uint64        `json:"id"`
+	OldLevel string        `json:"oldlevel"`
+	Status   models.Status `json:"status"`
+}
+
+// Filter is the filter of subscriber, empty field match all.
+type Filter struct {
+	// Ns match the events of ns and its child ns.
+	Ns           string
+	AlarmVersion string
+	Level        string
+}
+
+func (f Filter) match(e Event) bool {
+	return (f.Ns == "" || strings.HasSuffix("."+e.Status.Ns, "."+f.Ns)) &&
+		(f.AlarmVersion == "" || f.AlarmVersion == e.Status.AlarmVersion) &&
+		(f.Level == "" || f.Level == e.Status.Level)
+}
+
+// Subscriber receive the events matched by its filter from C.
+// C is closed if the subscriber is lagged or unsubscribed.
+type Subscriber struct {
+	C      <-chan Event
+	c      chan Event
+	filter Filter
+	b      *Broker
+	lagged bool
+}
+
+// Lagged return the subscriber is dropped for too many pending events or not.
+func (s *Subscriber) Lagged() bool {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	return s.lagged
+}
+
+// Broker keep the recent events and the subscribers.
+type Broker struct {
+	mu     sync.Mutex
+	seq    uint64
+	buffer []Event
+	subs   map[*Subscriber]struct{}
+}
+
+// NewBroker return Broker, the event ID starts from the current time,
+// so the ID before restart is older than all IDs after.
+func NewBroker() *Broker {
+	return &Broker{
+		seq:  uint64(time.Now().UnixNano()/int64(time.Millisecond)) * 1000,
+		subs: make(map[*Subscriber]struct{}),
+	}
+}
+
+var defaultBroker = NewBroker()
+
+// Publish broadcast the status transition.
+func Publish(oldLevel string, status models.Status) {
+	defaultBroker.Publish(oldLevel, status)
+}
+
+// Subscribe subscribe the events matched by filter, see Broker.Subscribe.
+func Subscribe(filter Filter, after uint64) (*Subscriber, []Event, bool) {
+	return defaultBroker.Subscribe(filter, after)
+}
+
+// Unsubscribe remove the subscriber.
+func Unsubscribe(s *Subscriber) {
+	defaultBroker.Unsubscribe(s)
+}
+
+// Publish keep the event and send it to the subscribers matched.
+// The subscriber is dropped if its queue is full, the publisher is never blocked.
+func (b *Broker) Publish(oldLevel string, status models.Status) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e := Event{ID: b.seq, OldLevel: oldLevel, Status: status}
+	b.buffer = append(b.buffer, e)
+	if len(b.buffer) > bufferSize {
+		b.buffer = b.buffer[len(b.buffer)-bufferSize:]
+	}
+	for s := range b.subs {
+		if !s.filter.match(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			s.lagged = true
+			close(s.c)
+			delete(b.subs, s)
+		}
+	}
+}
+
+// Subscribe return the subscriber of events matched by filter, and the kept events after the ID to resume.
+// Only the new events are subscribed if after is 0.
+// Return missed is true if some events after the ID are not kept, the subscriber should reload the status.
+func (b *Broker) Subscribe(filter Filter, after uint64) (s *Subscriber, replay []Event, missed bool) {
+	c := make(chan Event, queueSize)
+	s = &Subscriber{C: c, c: c, filter: filter, b: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[s] = struct{}{}
+	if after == 0 {
+		return s, nil, false
+	}
+	switch {
+	case after > b.seq:
+		missed = true
+	case len(b.buffer) == 0:
+		missed = after < b.seq
+	default:
+		missed = after+1 < b.buffer[0].ID
+	}
+	for _, e := range b.buffer {
+		if e.ID > after && filter.match(e) {
+			replay = append(replay, e)
+		}
+	}
+	return s, replay, missed
+}
+
+// Unsubscribe remove the subscriber and close its channel.
+func (b *Broker) Unsubscribe(s *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.c)
+	}
+}
@@ -1,10 +1,12 @@
 package work
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lodastack/event/cluster"
 	"github.com/lodastack/event/loda"
 	"github.com/lodastack/log"
 
@@ -51,12 +53,22 @@ func (b *block) ClearBlock(ns, alarmVersion, hostname string, tag map[string]str
 }
 
 // IsBlock check the ns/alarm/host is block or not, set the block status and times.
+// The block status is created by CAS, only the instance created it is not blocked,
+// so the concurrent events of the same status notify once across instances.
 func (b *block) IsBlock(ns string, alarm *loda.Alarm, hostname string, tag map[string]string) bool {
 	tagString := encodeTags(tag)
 	newBlockStatus, newBlockStatusTTL, newBlockTimes, newBlockTimesTTL, isBlock := b.readBlock(ns, alarm, hostname, tagString)
 	if newBlockStatus != noAction && newBlockTimes != noAction {
-		b.setBlockStatus(ns, alarm.AlarmData.Version, hostname, tagString, newBlockStatus, newBlockStatusTTL)
-		b.setBlockTimes(ns, alarm.AlarmData.Version, hostname, tagString, newBlockTimes, newBlockTimesTTL)
+		if err := b.setBlockStatus(ns, alarm.AlarmData.Version, hostname, tagString, newBlockStatus, newBlockStatusTTL); err != nil {
+			if errors.Is(err, cluster.ErrKeyExists) {
+				log.Infof("ns %s alarm %s host %s is blocked by other event", ns, alarm.AlarmData.Version, hostname)
+				return true
+			}
+			log.Errorf("set block status of ns %s alarm %s host %s fail: %s", ns, alarm.AlarmData.Version, hostname, err.Error())
+		}
+		if err := b.setBlockTimes(ns, alarm.AlarmData.Version, hostname, tagString, newBlockTimes, newBlockTimesTTL); err != nil {
+			log.Errorf("set block times of ns %s alarm %s host %s fail: %s", ns, alarm.AlarmData.Version, hostname, err.Error())
+		}
 	}
 	return isBlock
 }
@@ -156,12 +168,12 @@ func (b *block) readFromCluster(k string) (int, error) {
 	return v, nil
 }
 
-// set block status with ttl for ns/alarmVersion/host.
+// set block status with ttl for ns/alarmVersion/host, fail if the block status exists.
 func (b *block) setBlockStatus(ns, alarmVersion, hostname, tagString string, status, statusTTL int) error {
-	return b.c.SetWithTTL(
+	return b.c.Set(
 		BlockStatusKey(ns, alarmVersion, hostname, tagString),
 		strconv.Itoa(int(status)),
-		time.Duration(statusTTL)*time.Minute-5*time.Second)
+		&client.SetOptions{PrevExist: client.PrevNoExist, TTL: time.Duration(statusTTL)*time.Minute - 5*time.Second})
 }
 
 // set block times with ttl for ns/alarmVersion/host.
@@ -0,0 +1,62 @@
+package work
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/lodastack/event/loda"
+	m "github.com/lodastack/models"
+)
+
+func testAlarm() *loda.Alarm {
+	return &loda.Alarm{AlarmData: m.Alarm{Version: "cpu_v1", Every: "1"}, BlockStep: 5, MaxStackTime: 60}
+}
+
+func TestIsBlock(t *testing.T) {
+	c, closeFn := newTestCluster(t)
+	defer closeFn()
+	b := NewBlock(c)
+	alarm, tags := testAlarm(), map[string]string{"cpu": "0"}
+
+	if b.IsBlock("a.loda", alarm, "h1", tags) {
+		t.Fatal("the first event is blocked")
+	}
+	if !b.IsBlock("a.loda", alarm, "h1", tags) {
+		t.Fatal("the event in block is not blocked")
+	}
+	if b.IsBlock("a.loda", alarm, "h2", tags) {
+		t.Fatal("the first event of other host is blocked")
+	}
+	if err := b.ClearBlock("a.loda", alarm.AlarmData.Version, "h1", tags); err != nil {
+		t.Fatalf("clear block: %s", err)
+	}
+	if b.IsBlock("a.loda", alarm, "h1", tags) {
+		t.Fatal("the event after block cleared is blocked")
+	}
+}
+
+func TestIsBlockConcurrent(t *testing.T) {
+	c, closeFn := newTestCluster(t)
+	defer closeFn()
+	alarm := testAlarm()
+
+	// the instances race to create the block status, only one of them is not blocked.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var notBlocked int
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !NewBlock(c).IsBlock("a.loda", alarm, "h1", nil) {
+				mu.Lock()
+				notBlocked++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if notBlocked != 1 {
+		t.Fatalf("expect 1 event not blocked, got %d", notBlocked)
+	}
+}
@@ -17,24 +17,51 @@ type Cluster interface {
 	Set(k, v string, option *client.SetOptions) error
 	SetWithTTL(k, v string, duration time.Duration) error
 	Remove(key string) error
+	CompareAndRemove(key, prevValue string) error
 	RemoveDir(k string) error
 	RecursiveGet(k string) (*client.Response, error)
 	Mkdir(k string) error
+	Watcher(k string, afterIndex uint64) client.Watcher
+	Close() error
 }
 
 const (
 	statusPath = "status"
 	blockPath  = "block"
+	ackPath    = "ack"
+
+	// escalationStatePath keep the last escalated step of the status.
+	escalationStatePath = "escalation"
 
 	blockStatus = "blockstatus"
 	blockTimes  = "blocktimes"
 	noneTags    = "none"
+
+	// reservedPrefix is the prefix of the dir keep data other than ns status,
+	// such as silences. The reserved dir is not treated as ns.
+	reservedPrefix = "_"
+	silencePath    = reservedPrefix + "silence"
+	escalationPath = reservedPrefix + "escalation"
+	schedulePath   = reservedPrefix + "schedule"
+	flapPath       = reservedPrefix + "flap"
+	leaderPath     = reservedPrefix + "leader"
+	membersPath    = reservedPrefix + "members"
+	dedupPath      = reservedPrefix + "dedup"
 )
 
 func isStatusPath(path string) bool {
 	return ReadEtcdLastSplit(path) == statusPath
 }
 
+func isAckPath(path string) bool {
+	return ReadEtcdLastSplit(path) == ackPath
+}
+
+// isReservedDir return the etcd dir is reserved or not.
+func isReservedDir(path string) bool {
+	return strings.HasPrefix(ReadEtcdLastSplit(path), reservedPrefix)
+}
+
 // ReadEtcdLastSplit return the minimum dir/key of a etcd path.
 func ReadEtcdLastSplit(etcdPath string) string {
 	etcdKeySplit := strings.Split(etcdPath, "/")
@@ -67,6 +94,32 @@ func StatusKey(ns, alarmVersion, host, tagString string) string {
 	return TagDir(ns, alarmVersion, host, tagString) + "/" + statusPath
 }
 
+// AckKey return the relative path to keep the ack of ns/alarm/tag status.
+func AckKey(ns, alarmVersion, host, tagString string) string {
+	return TagDir(ns, alarmVersion, host, tagString) + "/" + ackPath
+}
+
+// EscalationStateKey return the relative path to keep the escalation state of ns/alarm/tag status.
+func EscalationStateKey(ns, alarmVersion, host, tagString string) string {
+	return TagDir(ns, alarmVersion, host, tagString) + "/" + escalationStatePath
+}
+
+// EscalationKey return the relative path to keep the escalation policy.
+func EscalationKey(name string) string {
+	return escalationPath + "/" + name
+}
+
+// ScheduleKey return the relative path to keep the on-call schedule.
+func ScheduleKey(name string) string {
+	return schedulePath + "/" + name
+}
+
+// FlapKey return the relative path to keep the flap state of ns/alarm/tag status.
+// The flap state is kept out of the tag dir, so it is not cleared with the block.
+func FlapKey(ns, alarmVersion, host, tagString string) string {
+	return flapPath + "/" + TagDir(ns, alarmVersion, host, tagString)
+}
+
 // blockDir return the dir to keep block status and times of ns/alarm/tag.
 func blockDir(ns, alarmVersion, host, tagString string) string {
 	return TagDir(ns, alarmVersion, host, tagString) + "/" + blockPath
@@ -85,6 +138,21 @@ func BlockTimesKey(ns, alarmVersion, host, tagString string) string {
 	return blockDir(ns, alarmVersion, host, tagString) + "/" + blockTimes
 }
 
+// DedupKey return the relative path to keep the idempotency key of event.
+func DedupKey(id string) string {
+	return dedupPath + "/" + id
+}
+
+// MemberKey return the relative path to keep the member of cluster.
+func MemberKey(id string) string {
+	return membersPath + "/" + id
+}
+
+// SilenceKey return the relative path to keep the silence.
+func SilenceKey(id string) string {
+	return silencePath + "/" + id
+}
+
 func encodeTags(m map[string]string) string {
 	// Empty maps marshal to empty bytes.
 	if len(m) == 0 {
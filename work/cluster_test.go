@@ -0,0 +1,29 @@
+package work
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lodastack/event/cluster"
+	"github.com/lodastack/event/config"
+)
+
+// newTestCluster return the cluster on a temporary boltdb.
+func newTestCluster(t *testing.T) (Cluster, func()) {
+	config.GetConfig().Etcd.Path = "/event"
+	dir, err := ioutil.TempDir("", "cluster")
+	if err != nil {
+		t.Fatalf("make temp dir: %s", err)
+	}
+	c, err := cluster.NewBoltCluster(filepath.Join(dir, "cluster.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("new bolt cluster: %s", err)
+	}
+	return c, func() {
+		c.Close()
+		os.RemoveAll(dir)
+	}
+}
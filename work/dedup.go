@@ -0,0 +1,70 @@
+package work
+
+import (
+	"crypto/md5"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lodastack/event/cluster"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+
+	"github.com/coreos/etcd/client"
+)
+
+// dedupTTL is how long the idempotency key of event is kept,
+// the same event delivered again in the TTL is dropped.
+const dedupTTL = 10 * time.Minute
+
+// eventID return the idempotency key of the event derived from the alert ID and event time.
+// Return empty if the event has no alert ID.
+func eventID(ns, alarmVersion string, eventData models.EventData) string {
+	if eventData.ID == "" {
+		return ""
+	}
+	return md5Byte2string(md5.Sum([]byte(ns + "|" + alarmVersion + "|" + eventData.ID + "|" +
+		strconv.FormatInt(eventData.Time.UnixNano(), 10))))
+}
+
+// claimEvent create the idempotency key of the event on cluster,
+// return false if the event is already claimed by this or other instance.
+// The event is handled if the cluster fails, duplicate notify is better than missing.
+func (w *Work) claimEvent(id string) bool {
+	if id == "" {
+		return true
+	}
+	err := w.Cluster.Set(DedupKey(id), strconv.FormatInt(time.Now().Unix(), 10),
+		&client.SetOptions{PrevExist: client.PrevNoExist, TTL: dedupTTL})
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, cluster.ErrKeyExists) {
+		return false
+	}
+	log.Errorf("claim event %s fail, handle it anyway: %s", id, err.Error())
+	return true
+}
+
+// markEvent record the failure of the event handled partially on its idempotency key.
+func (w *Work) markEvent(id string, handleErr error) {
+	if id == "" {
+		return
+	}
+	err := w.Cluster.Set(DedupKey(id), strconv.FormatInt(time.Now().Unix(), 10)+" partial: "+handleErr.Error(),
+		&client.SetOptions{PrevExist: client.PrevExist, TTL: dedupTTL})
+	if err != nil {
+		log.Errorf("mark event %s partial fail: %s", id, err.Error())
+	}
+}
+
+// releaseEvent remove the idempotency key, so the event can be handled again when redelivered.
+func (w *Work) releaseEvent(id string) {
+	if id == "" {
+		return
+	}
+	if err := w.Cluster.Remove(AbsPath(DedupKey(id))); err != nil && !strings.Contains(err.Error(), "Key not found") {
+		log.Errorf("release event %s fail: %s", id, err.Error())
+	}
+}
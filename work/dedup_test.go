@@ -0,0 +1,51 @@
+package work
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lodastack/event/models"
+)
+
+func TestClaimEvent(t *testing.T) {
+	c, closeFn := newTestCluster(t)
+	defer closeFn()
+	w := &Work{Cluster: c}
+
+	var eventData models.EventData
+	if id := eventID("a.loda", "cpu_v1", eventData); id != "" || !w.claimEvent(id) || !w.claimEvent(id) {
+		t.Fatal("the event without alert ID is always handled")
+	}
+	eventData.ID, eventData.Time = "cpu:h1", time.Now()
+	id := eventID("a.loda", "cpu_v1", eventData)
+	if other := eventID("a.loda", "cpu_v2", eventData); other == id {
+		t.Fatal("the event of other alarm has the same ID")
+	}
+
+	if !w.claimEvent(id) {
+		t.Fatal("the first event is not claimed")
+	}
+	if w.claimEvent(id) {
+		t.Fatal("the redelivered event is claimed")
+	}
+	// the event failed before any side effect can be handled again.
+	w.releaseEvent(id)
+	if !w.claimEvent(id) {
+		t.Fatal("the released event is not claimed")
+	}
+
+	// the event failed partially keep its claim with the outcome.
+	w.markEvent(id, errors.New("notify fail"))
+	if w.claimEvent(id) {
+		t.Fatal("the event handled partially is claimed again")
+	}
+	resp, err := c.Get(DedupKey(id), nil)
+	if err != nil {
+		t.Fatalf("get dedup key: %s", err)
+	}
+	if !strings.HasSuffix(resp.Node.Value, " partial: notify fail") || resp.Node.Expiration == nil {
+		t.Fatalf("unexpected dedup key: %+v", resp.Node)
+	}
+}
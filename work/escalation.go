@@ -0,0 +1,282 @@
+package work
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/common"
+	"github.com/lodastack/event/loda"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+	m "github.com/lodastack/models"
+
+	"github.com/coreos/etcd/client"
+)
+
+// escalateInterval is the interval to check the not acked status and escalate it.
+var escalateInterval = 30 * time.Second
+
+// ErrEscalationNotFound is returned if the escalation policy is not exist.
+var ErrEscalationNotFound = errors.New("escalation not found")
+
+// Escalator is a simplified interface for manager escalation policies on cluster.
+type Escalator interface {
+	// List return all escalation policies.
+	List() []models.EscalationPolicy
+
+	// Get return the escalation policy by name.
+	Get(name string) (models.EscalationPolicy, error)
+
+	// Set create or update the escalation policy.
+	Set(policy models.EscalationPolicy) (models.EscalationPolicy, error)
+
+	// Remove remove the escalation policy by name.
+	Remove(name string) error
+
+	// Match return the escalation policy of the ns/alarm.
+	// The policy of the alarm is preferred, then the policy of the nearest ns.
+	Match(ns, alarmVersion, alarmName string) (models.EscalationPolicy, bool)
+
+	// Load read escalation policies from cluster to local.
+	Load() error
+}
+
+// NewEscalator return Escalator.
+func NewEscalator(c Cluster) Escalator {
+	return &escalator{c: c, policies: make(map[string]models.EscalationPolicy)}
+}
+
+type escalator struct {
+	c Cluster
+
+	mu       sync.RWMutex
+	policies map[string]models.EscalationPolicy
+}
+
+// List return all escalation policies order by name.
+func (e *escalator) List() []models.EscalationPolicy {
+	e.mu.RLock()
+	output := make([]models.EscalationPolicy, 0, len(e.policies))
+	for _, policy := range e.policies {
+		output = append(output, policy)
+	}
+	e.mu.RUnlock()
+	sort.Slice(output, func(i, j int) bool { return output[i].Name < output[j].Name })
+	return output
+}
+
+// Get return the escalation policy by name.
+func (e *escalator) Get(name string) (models.EscalationPolicy, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	policy, ok := e.policies[name]
+	if !ok {
+		return policy, ErrEscalationNotFound
+	}
+	return policy, nil
+}
+
+// Set create or update the escalation policy to cluster.
+func (e *escalator) Set(policy models.EscalationPolicy) (models.EscalationPolicy, error) {
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return policy, err
+	}
+	if err := e.c.Set(EscalationKey(policy.Name), string(b), &client.SetOptions{}); err != nil {
+		return policy, err
+	}
+
+	e.mu.Lock()
+	e.policies[policy.Name] = policy
+	e.mu.Unlock()
+	return policy, nil
+}
+
+// Remove the escalation policy from cluster.
+func (e *escalator) Remove(name string) error {
+	if _, err := e.Get(name); err != nil {
+		return err
+	}
+	if err := e.c.Remove(AbsPath(EscalationKey(name))); err != nil && !strings.Contains(err.Error(), "Key not found") {
+		return err
+	}
+	e.mu.Lock()
+	delete(e.policies, name)
+	e.mu.Unlock()
+	return nil
+}
+
+// Match return the escalation policy of the alarm, or the policy of the nearest ns.
+func (e *escalator) Match(ns, alarmVersion, alarmName string) (models.EscalationPolicy, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var matched models.EscalationPolicy
+	var ok bool
+	for _, policy := range e.policies {
+		if !policy.Match(ns, alarmVersion, alarmName) {
+			continue
+		}
+		if !ok || preferPolicy(policy, matched) {
+			matched, ok = policy, true
+		}
+	}
+	return matched, ok
+}
+
+// preferPolicy return p is preferred to q or not.
+// The alarm policy is preferred to the ns policy, then the policy of the nearer ns.
+func preferPolicy(p, q models.EscalationPolicy) bool {
+	if (p.Alarm != "") != (q.Alarm != "") {
+		return p.Alarm != ""
+	}
+	return len(p.Ns) > len(q.Ns)
+}
+
+// Load read all escalation policies from cluster and replace the local policies.
+func (e *escalator) Load() error {
+	policies := make(map[string]models.EscalationPolicy)
+	rep, err := e.c.RecursiveGet(escalationPath)
+	if err != nil {
+		if !strings.Contains(err.Error(), "Key not found") {
+			return err
+		}
+	} else {
+		for _, node := range rep.Node.Nodes {
+			var policy models.EscalationPolicy
+			if err := json.Unmarshal([]byte(node.Value), &policy); err != nil {
+				log.Errorf("unmarshal escalation %s fail: %s", node.Key, err.Error())
+				continue
+			}
+			policies[policy.Name] = policy
+		}
+	}
+
+	e.mu.Lock()
+	e.policies = policies
+	e.mu.Unlock()
+	return nil
+}
+
+// EscalateLoop check the not OK and not acked status periodically, notify the due escalation steps.
+// The escalation state is kept on cluster and updated by compare-and-swap,
+// so every step is notified exactly once across event instances and restarts.
+// Only the leader escalates.
+func (w *Work) EscalateLoop(ctx context.Context) {
+	for {
+		if err := w.Escalation.Load(); err != nil {
+			log.Errorf("load escalations: %s", err)
+		}
+		if w.Election.IsLeader() {
+			w.escalate()
+		}
+		if !sleep(ctx, escalateInterval) {
+			return
+		}
+	}
+}
+
+func (w *Work) escalate() {
+	// collect the status to escalate.
+	statusList := make([]models.Status, 0)
+	models.StatusMu.RLock()
+	for _, alarmStatus := range models.StatusData {
+		for _, hostStatus := range alarmStatus {
+			for _, tagStatus := range hostStatus {
+				for _, status := range tagStatus {
+					if status.Level == "" || status.Level == common.OK || status.Ack != nil || status.Flapping {
+						continue
+					}
+					statusList = append(statusList, status)
+				}
+			}
+		}
+	}
+	models.StatusMu.RUnlock()
+
+	for _, status := range statusList {
+		policy, ok := w.Escalation.Match(status.Ns, status.AlarmVersion, status.Name)
+		if !ok {
+			continue
+		}
+		if _, silenced := w.Silence.Match(status.Ns, status.AlarmVersion, status.Name, status.Host, status.Tags); silenced {
+			continue
+		}
+		due := policy.DueStep(time.Since(status.CreateTime))
+		if due < 0 {
+			continue
+		}
+		loda.Alarms.RLock()
+		alarm, ok := loda.Alarms.NsAlarms[status.Ns][status.AlarmVersion]
+		loda.Alarms.RUnlock()
+		if !ok {
+			log.Errorf("read ns %s alarm %s alarm data error, not escalate", status.Ns, status.AlarmVersion)
+			continue
+		}
+		// not escalate out of the active window of alarm, same as the notify.
+		if window := outOfWindow(alarm.AlarmData, time.Now()); window != "" {
+			log.Debugf("ns %s alarm %s is out of active window %s, not escalate", status.Ns, status.AlarmVersion, window)
+			continue
+		}
+		w.escalateStatus(policy, alarm.AlarmData, status, due)
+	}
+}
+
+// escalateStatus notify the steps not escalated until due step.
+func (w *Work) escalateStatus(policy models.EscalationPolicy, alarm m.Alarm, status models.Status, due int) {
+	key := EscalationStateKey(status.Ns, status.AlarmVersion, status.Host, status.TagString)
+	state := models.EscalationState{Since: status.CreateTime.Unix(), Step: -1}
+	option := &client.SetOptions{PrevExist: client.PrevNoExist}
+	if resp, err := w.Cluster.Get(key, &client.GetOptions{}); err == nil {
+		var oldState models.EscalationState
+		if err := json.Unmarshal([]byte(resp.Node.Value), &oldState); err == nil && oldState.Since == state.Since {
+			state.Step = oldState.Step
+		}
+		option = &client.SetOptions{PrevIndex: resp.Node.ModifiedIndex}
+	}
+	if state.Step >= due {
+		return
+	}
+
+	lastStep := state.Step
+	state.Step = due
+	b, _ := json.Marshal(state)
+	if err := w.Cluster.Set(key, string(b), option); err != nil {
+		// other instance has escalated the status.
+		log.Debugf("update escalation state %s fail: %s", key, err.Error())
+		return
+	}
+
+	for i := lastStep + 1; i <= due; i++ {
+		step := policy.Steps[i]
+		groups, alertTypes := step.Groups, step.Alert
+		if len(groups) == 0 {
+			groups = strings.Split(alarm.Groups, ",")
+		}
+		if len(alertTypes) == 0 {
+			alertTypes = strings.Split(alarm.Alert, ",")
+		}
+		receivers := loda.GetGroupUsersByRole(groups, step.Role)
+		if len(receivers) == 0 {
+			log.Errorf("escalation %s step %d of ns %s alarm %s has no receiver", policy.Name, i, status.Ns, status.AlarmVersion)
+			continue
+		}
+
+		log.Infof("escalate ns %s alarm %s host %s by %s step %d to %v",
+			status.Ns, status.AlarmVersion, status.Host, policy.Name, i, receivers)
+		notifyData := models.NewAlertMsg(
+			status.Ns, status.Host, status.Ip, status.Measurement,
+			status.Level, "[escalated] "+status.Name, alarm.Expression+alarm.Value,
+			receivers, status.Tags, status.Value, status.UpdateTime)
+		if err := sentToAlertHandler(alarm.Level, alertTypes, notifyData); err != nil {
+			log.Errorf("escalate ns %s alarm %s host %s fail: %s", status.Ns, status.AlarmVersion, status.Host, err.Error())
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package work
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+
+	"github.com/coreos/etcd/client"
+)
+
+const (
+	defaultFlapWindow = 1800 // unit: second
+	flapRetry         = 3
+)
+
+// Flapper is a simplified interface for detect the flapping status.
+type Flapper interface {
+	// Record the level of ns/alarm/host/tag status, return it is flapping or not.
+	// started is true only once when the status starts flapping.
+	Record(ns, alarmVersion, hostname, tagString, level string) (flapping, started bool)
+}
+
+// NewFlapper return Flapper.
+func NewFlapper(c Cluster) Flapper {
+	return &flapper{c: c}
+}
+
+type flapper struct {
+	c Cluster
+}
+
+// Record the level to the flap state on cluster.
+// The state is updated by CAS, so only one instance see the flapping started.
+func (f *flapper) Record(ns, alarmVersion, hostname, tagString, level string) (bool, bool) {
+	conf := config.GetConfig().Flap
+	if conf.Threshold < 1 {
+		return false, false
+	}
+	window, recover := conf.Window, conf.Recover
+	if window < 1 {
+		window = defaultFlapWindow
+	}
+	if recover < 1 || recover > conf.Threshold {
+		recover = conf.Threshold / 2
+	}
+
+	key := FlapKey(ns, alarmVersion, hostname, tagString)
+	for i := 0; i < flapRetry; i++ {
+		var state models.FlapState
+		option := &client.SetOptions{PrevExist: client.PrevNoExist}
+		if resp, err := f.c.Get(key, &client.GetOptions{}); err == nil {
+			if err := json.Unmarshal([]byte(resp.Node.Value), &state); err != nil {
+				log.Errorf("unmarshal flap state %s fail: %s", key, err.Error())
+			}
+			option = &client.SetOptions{PrevIndex: resp.Node.ModifiedIndex}
+		}
+		wasFlapping := state.Flapping
+		if !state.Record(level, time.Now(), time.Duration(window)*time.Second, conf.Threshold, recover) {
+			return state.Flapping, false
+		}
+
+		// the state expires if the level is not changed in the window.
+		option.TTL = time.Duration(window) * time.Second
+		b, _ := json.Marshal(state)
+		if err := f.c.Set(key, string(b), option); err != nil {
+			// other instance has updated the state, read and retry.
+			log.Debugf("update flap state %s fail: %s", key, err.Error())
+			continue
+		}
+		if wasFlapping && !state.Flapping {
+			log.Infof("ns %s alarm %s host %s stops flapping", ns, alarmVersion, hostname)
+		}
+		return state.Flapping, !wasFlapping && state.Flapping
+	}
+	log.Errorf("update flap state %s fail after %d retries", key, flapRetry)
+	return false, false
+}
@@ -0,0 +1,111 @@
+package work
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/loda"
+)
+
+const (
+	// alarmsMaxAge is the max age of alarms refreshed every 2 minutes.
+	alarmsMaxAge = 10 * time.Minute
+	// machinesMaxAge is the max age of machines refreshed every minute.
+	machinesMaxAge = 5 * time.Minute
+)
+
+// Check is the result of checking a dependency.
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// Health check the dependencies of event, return healthy if all checks are ok.
+func (w *Work) Health() (bool, []Check) {
+	return allOK([]Check{
+		w.checkCluster(),
+		checkRefresh("alarms", loda.AlarmsUpdated(), alarmsMaxAge),
+		checkRefresh("machines", loda.MachinesUpdated(), machinesMaxAge),
+		w.checkStatusCache(),
+		checkScript("sms", config.GetConfig().Sms.Script),
+		checkScript("wechat", config.GetConfig().Wechat.Script),
+	})
+}
+
+// Ready check the instance can handle events, return ready if the cluster is reachable
+// and the alarms, machines and status are loaded.
+func (w *Work) Ready() (bool, []Check) {
+	alarms := Check{Name: "alarms", OK: loda.AlarmsLoaded(), Message: "loaded"}
+	if !alarms.OK {
+		alarms.Message = "initial load is not finished"
+	}
+	machines := Check{Name: "machines", OK: !loda.MachinesUpdated().IsZero(), Message: "loaded"}
+	if !machines.OK {
+		machines.Message = "initial load is not finished"
+	}
+	cache := Check{Name: "status", OK: !w.Status.CacheStats().LastSync.IsZero(), Message: "synced"}
+	if !cache.OK {
+		cache.Message = "status is not synced from cluster"
+	}
+	return allOK([]Check{w.checkCluster(), alarms, machines, cache})
+}
+
+func allOK(checks []Check) (bool, []Check) {
+	for _, c := range checks {
+		if !c.OK {
+			return false, checks
+		}
+	}
+	return true, checks
+}
+
+// checkCluster read the leader to check the cluster is reachable.
+func (w *Work) checkCluster() Check {
+	leader, err := w.Election.Leader()
+	if err != nil {
+		return Check{Name: "cluster", Message: err.Error()}
+	}
+	return Check{Name: "cluster", OK: true, Message: "leader: " + leader}
+}
+
+func checkRefresh(name string, updated time.Time, maxAge time.Duration) Check {
+	if updated.IsZero() {
+		return Check{Name: name, Message: "never refreshed from registry"}
+	}
+	age := time.Since(updated)
+	return Check{
+		Name:    name,
+		OK:      age <= maxAge,
+		Message: fmt.Sprintf("refreshed %s ago", age.Truncate(time.Second)),
+	}
+}
+
+func (w *Work) checkStatusCache() Check {
+	stats := w.Status.CacheStats()
+	switch {
+	case stats.LastSync.IsZero():
+		return Check{Name: "status", Message: "status is not synced from cluster"}
+	case !stats.Watching:
+		return Check{Name: "status", Message: fmt.Sprintf("watch is broken, last synced at %s", stats.LastSync.Format(timeFormat))}
+	}
+	return Check{
+		Name:    "status",
+		OK:      true,
+		Message: fmt.Sprintf("revision %d, behind %d, lag %.3fs", stats.Revision, stats.Behind, stats.Lag),
+	}
+}
+
+// checkScript check the output script exists, it is ok if the script is not configured.
+func checkScript(name, script string) Check {
+	name += " script"
+	if script == "" {
+		return Check{Name: name, OK: true, Message: "not configured"}
+	}
+	if _, err := os.Stat(script); err != nil {
+		return Check{Name: name, Message: err.Error()}
+	}
+	return Check{Name: name, OK: true, Message: script}
+}
@@ -0,0 +1,67 @@
+package work
+
+import (
+	"context"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/history"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+	m "github.com/lodastack/models"
+)
+
+const defaultHistoryRetention = 30 // unit: day
+
+// openHistory open the history store if configured, return nil if not.
+func openHistory(ctx context.Context) *history.Store {
+	conf := config.GetConfig().History
+	if conf.Path == "" {
+		log.Info("history is not configured, not keep the status transitions")
+		return nil
+	}
+	store, err := history.Open(conf.Path)
+	if err != nil {
+		log.Errorf("open history %s fail, not keep the status transitions: %s", conf.Path, err.Error())
+		return nil
+	}
+	retention := conf.Retention
+	if retention < 1 {
+		retention = defaultHistoryRetention
+	}
+	go store.RetentionLoop(ctx, time.Duration(retention)*24*time.Hour, conf.MaxRecords)
+	return store
+}
+
+// recordTransition keep the status transition and its notify outcome to history.
+func (w *Work) recordTransition(alarm m.Alarm, eventData models.EventData, t transition, receivers []string, outcome string, err error) {
+	if w.History == nil {
+		return
+	}
+	host, _ := eventData.Host()
+	record := history.Record{
+		Time:         eventData.Time,
+		Ns:           eventData.Ns,
+		AlarmVersion: alarm.Version,
+		AlarmName:    alarm.Name,
+		Host:         host,
+		Tags:         eventData.Tag(),
+		OldLevel:     t.oldLevel,
+		NewLevel:     eventData.Level.String(),
+		Value:        t.value,
+		Receivers:    receivers,
+		Notify:       outcome,
+	}
+	if t.oldLevel != "" {
+		record.Duration = eventData.Time.Sub(t.since)
+	}
+	if err != nil {
+		record.Error = err.Error()
+		if outcome == history.NotifySent {
+			record.Notify = history.NotifyFailed
+		}
+	}
+	if err := w.History.Add(record); err != nil {
+		log.Errorf("add history of ns %s alarm %s host %s fail: %s", eventData.Ns, alarm.Version, host, err.Error())
+	}
+}
@@ -0,0 +1,190 @@
+package work
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/log"
+
+	"github.com/coreos/etcd/client"
+)
+
+const (
+	// leaderTTL is the TTL of the leader and member keys,
+	// the leader is replaced if it does not refresh in the TTL.
+	leaderTTL         = 15 * time.Second
+	heartbeatInterval = 5 * time.Second
+)
+
+// Member is an event instance alive in the cluster.
+type Member struct {
+	ID         string    `json:"id"`
+	StartTime  time.Time `json:"starttime"`
+	UpdateTime time.Time `json:"updatetime"`
+	Leader     bool      `json:"leader"`
+}
+
+// Elector is a simplified interface for electing the leader among the event instances.
+// Only the leader runs the singleton jobs, such as the reconciliation with loda.
+type Elector interface {
+	// ID return the member identity of this instance.
+	ID() string
+
+	// IsLeader return this instance is the leader or not.
+	IsLeader() bool
+
+	// Leader return the member identity of the current leader.
+	Leader() (string, error)
+
+	// Members return the live members.
+	Members() ([]Member, error)
+
+	// CampaignLoop keep this instance alive as member, and campaign the leader periodically until ctx is done.
+	CampaignLoop(ctx context.Context)
+
+	// Resign remove this instance from members and give up the leader,
+	// so other instance takes over without waiting for the TTL.
+	Resign()
+}
+
+// NewElector return Elector, the member identity is the etcd addr in config,
+// or the hostname and listen address if it is empty.
+func NewElector(c Cluster) Elector {
+	id := config.GetConfig().Etcd.Addr
+	if id == "" {
+		hostname, _ := os.Hostname()
+		id = hostname + config.GetConfig().Com.Listen
+	}
+	// the identity is part of the member key.
+	id = strings.Replace(id, "/", "_", -1)
+	return &elector{c: c, id: id, start: time.Now()}
+}
+
+type elector struct {
+	c     Cluster
+	id    string
+	start time.Time
+
+	mu     sync.RWMutex
+	leader bool
+}
+
+func (e *elector) ID() string {
+	return e.id
+}
+
+func (e *elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Leader read the current leader from cluster.
+func (e *elector) Leader() (string, error) {
+	rep, err := e.c.Get(leaderPath, &client.GetOptions{})
+	if err != nil {
+		if strings.Contains(err.Error(), "Key not found") {
+			return "", nil
+		}
+		return "", err
+	}
+	return rep.Node.Value, nil
+}
+
+// Members read the live members from cluster.
+func (e *elector) Members() ([]Member, error) {
+	leader, err := e.Leader()
+	if err != nil {
+		return nil, err
+	}
+	output := make([]Member, 0)
+	rep, err := e.c.RecursiveGet(membersPath)
+	if err != nil {
+		if strings.Contains(err.Error(), "Key not found") {
+			return output, nil
+		}
+		return nil, err
+	}
+	for _, node := range rep.Node.Nodes {
+		var member Member
+		if err := json.Unmarshal([]byte(node.Value), &member); err != nil {
+			log.Errorf("unmarshal member %s fail: %s", node.Key, err.Error())
+			continue
+		}
+		member.Leader = member.ID == leader
+		output = append(output, member)
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].ID < output[j].ID })
+	return output, nil
+}
+
+func (e *elector) CampaignLoop(ctx context.Context) {
+	for {
+		e.heartbeat()
+		e.campaign()
+		if !sleep(ctx, heartbeatInterval) {
+			return
+		}
+	}
+}
+
+func (e *elector) Resign() {
+	e.mu.Lock()
+	leader := e.leader
+	e.leader = false
+	e.mu.Unlock()
+
+	if err := e.c.Remove(AbsPath(MemberKey(e.id))); err != nil && !strings.Contains(err.Error(), "Key not found") {
+		log.Errorf("remove member %s fail: %s", e.id, err.Error())
+	}
+	if !leader {
+		return
+	}
+	// the leader key may be taken by other instance after this instance lost it,
+	// remove it only if it is still this instance.
+	if err := e.c.CompareAndRemove(AbsPath(leaderPath), e.id); err != nil {
+		if cerr, ok := err.(client.Error); ok && (cerr.Code == client.ErrorCodeTestFailed || cerr.Code == client.ErrorCodeKeyNotFound) {
+			return
+		}
+		log.Errorf("resign leader %s fail: %s", e.id, err.Error())
+		return
+	}
+	log.Infof("%s resign the leader", e.id)
+}
+
+// heartbeat refresh the member key of this instance.
+func (e *elector) heartbeat() {
+	b, _ := json.Marshal(Member{ID: e.id, StartTime: e.start, UpdateTime: time.Now()})
+	if err := e.c.SetWithTTL(MemberKey(e.id), string(b), leaderTTL); err != nil {
+		log.Errorf("refresh member %s fail: %s", e.id, err.Error())
+	}
+}
+
+// campaign refresh the leader key if this instance is the leader,
+// otherwise try to create the leader key. The leader key is set by CAS,
+// so at most one instance is the leader in the TTL.
+func (e *elector) campaign() {
+	var err error
+	if e.IsLeader() {
+		err = e.c.Set(leaderPath, e.id, &client.SetOptions{PrevValue: e.id, TTL: leaderTTL})
+	} else {
+		err = e.c.Set(leaderPath, e.id, &client.SetOptions{PrevExist: client.PrevNoExist, TTL: leaderTTL})
+	}
+	leader := err == nil
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case leader && !e.leader:
+		log.Infof("%s is elected as leader", e.id)
+	case !leader && e.leader:
+		log.Warningf("%s is not leader any more: %s", e.id, err.Error())
+	}
+	e.leader = leader
+}
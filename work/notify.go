@@ -2,11 +2,13 @@ package work
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/lodastack/event/common"
 	"github.com/lodastack/event/models"
 	o "github.com/lodastack/event/output"
 	"github.com/lodastack/log"
+	m "github.com/lodastack/models"
 )
 
 var levelMap map[string]string
@@ -21,8 +23,16 @@ func init() {
 	}
 }
 
-func send(alarmName, alarmLevel, expression, alertLevel, ip string, alertTypes []string, recievers []string, eventData models.EventData) error {
-	if len(recievers) == 0 {
+// send notify the event of alarm to recievers and webhooks by the alert types of alarm.
+// ack is the acknowledgement of the status to show in the recovery notify, maybe nil.
+func send(alarm m.Alarm, alertLevel, ip string, recievers []string, eventData models.EventData, ack *models.Ack) error {
+	alarmName, alarmLevel, expression := alarm.Name, alarm.Level, alarm.Expression+alarm.Value
+	alertTypes := strings.Split(alarm.Alert, ",")
+	webhooks := splitWebhooks(alarm.WebHooks)
+	if len(webhooks) != 0 {
+		alertTypes = append(alertTypes, o.Webhook)
+	}
+	if len(recievers) == 0 && len(webhooks) == 0 {
 		return errors.New("empty recieve: ns:" + eventData.Ns + " Name:" + alarmName)
 	}
 
@@ -43,27 +53,47 @@ func send(alarmName, alarmLevel, expression, alertLevel, ip string, alertTypes [
 		eventData.Ns, host, ip, measurement,
 		eventData.Level.String(), alarmName, expression, recievers, tags,
 		value, eventData.Time)
-	go sentToAlertHandler(alertLevel, alertTypes, alertMsg)
-	return nil
+	alertMsg.WebHooks = webhooks
+	alertMsg.Ack = ack
+	alertMsg.Message = alarm.Message
+	if !eventData.Since.IsZero() {
+		alertMsg.Duration = eventData.Time.Sub(eventData.Since)
+	}
+	return sentToAlertHandler(alertLevel, alertTypes, alertMsg)
 }
 
-// send the alertMsg to sms/mail/wechat handler.
+// splitWebhooks return the webhook url list of the alarm WebHooks property.
+func splitWebhooks(webhooks string) []string {
+	output := make([]string, 0)
+	for _, url := range strings.Split(webhooks, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			output = append(output, url)
+		}
+	}
+	return output
+}
+
+// send the alertMsg to the pool of sms/mail/wechat/webhook handler,
+// return the errors of all handlers failed in one error.
 func sentToAlertHandler(alertLevel string, alertType []string, noitfyData models.NotifyData) error {
 	if alertLevel == "1" {
 		alertType = append(alertType, "wechat")
 	}
 	alertType = common.RemoveDuplicateAndEmpty(alertType)
 
+	var errs []string
 	for _, handler := range alertType {
-		handlerFunc, ok := o.Handlers[handler]
-		if !ok {
+		if _, ok := o.Handlers[handler]; !ok {
 			log.Errorf("Unknow alert type %s.", handler)
 			continue
 		}
-		if err := handlerFunc(noitfyData); err != nil {
-			log.Errorf("output %s fail: %s", handler, err.Error())
-			return err
+		if err := o.Submit(handler, noitfyData); err != nil {
+			log.Errorf("submit output %s fail: %s", handler, err.Error())
+			errs = append(errs, handler+": "+err.Error())
 		}
 	}
-	return nil
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New("submit output fail: " + strings.Join(errs, "; "))
 }
@@ -0,0 +1,168 @@
+package work
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/common"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+
+	"github.com/coreos/etcd/client"
+)
+
+// ErrScheduleNotFound is returned if the schedule is not exist.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// Scheduler is a simplified interface for manager on-call schedules on cluster.
+type Scheduler interface {
+	// List return all schedules.
+	List() []models.Schedule
+
+	// Get return the schedule by name.
+	Get(name string) (models.Schedule, error)
+
+	// Set create or update the schedule.
+	Set(schedule models.Schedule) (models.Schedule, error)
+
+	// Remove remove the schedule by name.
+	Remove(name string) error
+
+	// ResolveGroup return the on-call users of the group at time t,
+	// ok is false if no schedule point at the group.
+	ResolveGroup(gname string, t time.Time) (users []string, ok bool)
+
+	// Load read schedules from cluster to local.
+	Load() error
+}
+
+// NewScheduler return Scheduler.
+func NewScheduler(c Cluster) Scheduler {
+	return &scheduler{c: c, schedules: make(map[string]models.Schedule)}
+}
+
+type scheduler struct {
+	c Cluster
+
+	mu        sync.RWMutex
+	schedules map[string]models.Schedule
+}
+
+// List return all schedules order by name.
+func (s *scheduler) List() []models.Schedule {
+	s.mu.RLock()
+	output := make([]models.Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		output = append(output, schedule)
+	}
+	s.mu.RUnlock()
+	sort.Slice(output, func(i, j int) bool { return output[i].Name < output[j].Name })
+	return output
+}
+
+// Get return the schedule by name.
+func (s *scheduler) Get(name string) (models.Schedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	schedule, ok := s.schedules[name]
+	if !ok {
+		return schedule, ErrScheduleNotFound
+	}
+	return schedule, nil
+}
+
+// Set create or update the schedule to cluster.
+// A group can point at one schedule only.
+func (s *scheduler) Set(schedule models.Schedule) (models.Schedule, error) {
+	if err := schedule.Validate(); err != nil {
+		return schedule, err
+	}
+	s.mu.RLock()
+	for _, other := range s.schedules {
+		if other.Name == schedule.Name {
+			continue
+		}
+		for _, gname := range schedule.Groups {
+			if _, ok := common.ContainString(other.Groups, gname); ok {
+				s.mu.RUnlock()
+				return schedule, errors.New("group " + gname + " already point at schedule " + other.Name)
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	b, err := json.Marshal(schedule)
+	if err != nil {
+		return schedule, err
+	}
+	if err := s.c.Set(ScheduleKey(schedule.Name), string(b), &client.SetOptions{}); err != nil {
+		return schedule, err
+	}
+
+	s.mu.Lock()
+	s.schedules[schedule.Name] = schedule
+	s.mu.Unlock()
+	return schedule, nil
+}
+
+// Remove the schedule from cluster.
+func (s *scheduler) Remove(name string) error {
+	if _, err := s.Get(name); err != nil {
+		return err
+	}
+	if err := s.c.Remove(AbsPath(ScheduleKey(name))); err != nil && !strings.Contains(err.Error(), "Key not found") {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.schedules, name)
+	s.mu.Unlock()
+	return nil
+}
+
+// ResolveGroup return the on-call users of the schedule the group point at.
+func (s *scheduler) ResolveGroup(gname string, t time.Time) ([]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, schedule := range s.schedules {
+		if _, ok := common.ContainString(schedule.Groups, gname); !ok {
+			continue
+		}
+		users := schedule.OnCall(t)
+		if len(users) == 0 {
+			// nobody is on call, fallback to all users of the group.
+			log.Warningf("schedule %s of group %s has no on-call user at %s", schedule.Name, gname, t.Format(timeFormat))
+			return nil, false
+		}
+		return users, true
+	}
+	return nil, false
+}
+
+// Load read all schedules from cluster and replace the local schedules.
+func (s *scheduler) Load() error {
+	schedules := make(map[string]models.Schedule)
+	rep, err := s.c.RecursiveGet(schedulePath)
+	if err != nil {
+		if !strings.Contains(err.Error(), "Key not found") {
+			return err
+		}
+	} else {
+		for _, node := range rep.Node.Nodes {
+			var schedule models.Schedule
+			if err := json.Unmarshal([]byte(node.Value), &schedule); err != nil {
+				log.Errorf("unmarshal schedule %s fail: %s", node.Key, err.Error())
+				continue
+			}
+			schedules[schedule.Name] = schedule
+		}
+	}
+
+	s.mu.Lock()
+	s.schedules = schedules
+	s.mu.Unlock()
+	return nil
+}
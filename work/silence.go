@@ -0,0 +1,176 @@
+package work
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+
+	"github.com/coreos/etcd/client"
+)
+
+// silenceRetention is how long the silence is kept after it ends.
+var silenceRetention = 24 * time.Hour
+
+// ErrSilenceNotFound is returned if the silence id is not exist.
+var ErrSilenceNotFound = errors.New("silence not found")
+
+// Silencer is a simplified interface for manager silences on cluster.
+type Silencer interface {
+	// List return all silences, only return the active silences if active is true.
+	List(active bool) []models.Silence
+
+	// Get return the silence by id.
+	Get(id string) (models.Silence, error)
+
+	// Set create the silence if it has no id, otherwise update it.
+	Set(silence models.Silence) (models.Silence, error)
+
+	// Remove remove the silence by id.
+	Remove(id string) error
+
+	// Match return the active silence which match the ns/alarm/host/tags.
+	Match(ns, alarmVersion, alarmName, host string, tags map[string]string) (models.Silence, bool)
+
+	// Load read silences from cluster to local.
+	Load() error
+}
+
+// NewSilencer return Silencer.
+func NewSilencer(c Cluster) Silencer {
+	return &silencer{c: c, silences: make(map[string]models.Silence)}
+}
+
+type silencer struct {
+	c Cluster
+
+	mu       sync.RWMutex
+	silences map[string]models.Silence
+}
+
+// List return all silences order by starttime.
+func (s *silencer) List(active bool) []models.Silence {
+	now := time.Now()
+	s.mu.RLock()
+	output := make([]models.Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		if active && !silence.Active(now) {
+			continue
+		}
+		output = append(output, silence)
+	}
+	s.mu.RUnlock()
+	sort.Slice(output, func(i, j int) bool { return output[i].StartTime.Before(output[j].StartTime) })
+	return output
+}
+
+// Get return the silence by id.
+func (s *silencer) Get(id string) (models.Silence, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	silence, ok := s.silences[id]
+	if !ok {
+		return silence, ErrSilenceNotFound
+	}
+	return silence, nil
+}
+
+// Set create or update the silence to cluster.
+// The silence key expires silenceRetention after its endtime.
+func (s *silencer) Set(silence models.Silence) (models.Silence, error) {
+	if silence.StartTime.IsZero() {
+		silence.StartTime = time.Now()
+	}
+	if err := silence.Validate(); err != nil {
+		return silence, err
+	}
+	if silence.ID == "" {
+		silence.ID = newSilenceID()
+		silence.CreateTime = time.Now()
+	} else if old, err := s.Get(silence.ID); err != nil {
+		return silence, err
+	} else {
+		silence.CreateTime = old.CreateTime
+	}
+
+	b, err := json.Marshal(silence)
+	if err != nil {
+		return silence, err
+	}
+	ttl := time.Until(silence.EndTime) + silenceRetention
+	if err := s.c.Set(SilenceKey(silence.ID), string(b), &client.SetOptions{TTL: ttl}); err != nil {
+		return silence, err
+	}
+
+	s.mu.Lock()
+	s.silences[silence.ID] = silence
+	s.mu.Unlock()
+	return silence, nil
+}
+
+// Remove the silence from cluster.
+func (s *silencer) Remove(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if err := s.c.Remove(AbsPath(SilenceKey(id))); err != nil && !strings.Contains(err.Error(), "Key not found") {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.silences, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// Match return the first active silence which match the ns/alarm/host/tags.
+func (s *silencer) Match(ns, alarmVersion, alarmName, host string, tags map[string]string) (models.Silence, bool) {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, silence := range s.silences {
+		if silence.Active(now) && silence.Match(ns, alarmVersion, alarmName, host, tags) {
+			return silence, true
+		}
+	}
+	return models.Silence{}, false
+}
+
+// Load read all silences from cluster and replace the local silences.
+func (s *silencer) Load() error {
+	silences := make(map[string]models.Silence)
+	rep, err := s.c.RecursiveGet(silencePath)
+	if err != nil {
+		if !strings.Contains(err.Error(), "Key not found") {
+			return err
+		}
+	} else {
+		for _, node := range rep.Node.Nodes {
+			var silence models.Silence
+			if err := json.Unmarshal([]byte(node.Value), &silence); err != nil {
+				log.Errorf("unmarshal silence %s fail: %s", node.Key, err.Error())
+				continue
+			}
+			silences[silence.ID] = silence
+		}
+	}
+
+	s.mu.Lock()
+	s.silences = silences
+	s.mu.Unlock()
+	return nil
+}
+
+func newSilenceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -1,8 +1,12 @@
 package work
 
 import (
+	"context"
+	"errors"
 	"strings"
+	"time"
 
+	"github.com/lodastack/event/common"
 	"github.com/lodastack/event/models"
 	"github.com/lodastack/log"
 	m "github.com/lodastack/models"
@@ -26,8 +30,26 @@ type ClusterStatus interface {
 
 	// GenGlobalStatus update global NsStatus according to cluster.
 	GenGlobalStatus() error
+
+	// WatchGlobalStatus load global NsStatus and keep it updated by watching cluster.
+	WatchGlobalStatus(ctx context.Context)
+
+	// CacheStats return the state of the local status synced from cluster.
+	CacheStats() CacheStats
+
+	// SetAck acknowledge the not OK status.
+	SetAck(ns, alarmVersion, hostname, tagString string, ack models.Ack) error
+
+	// GetAck return the ack of the status.
+	GetAck(ns, alarmVersion, hostname, tagString string) (models.Ack, error)
+
+	// ClearAck remove the ack of the status.
+	ClearAck(ns, alarmVersion, hostname, tagString string) error
 }
 
+// ErrNotAckable is returned if ack a status not exist or is OK.
+var ErrNotAckable = errors.New("status is not exist or OK")
+
 // LocalStatusInf is a simplified interface for manager status from local.
 type LocalStatusInf interface {
 	// GetStatusList return status list alarmVersion/host/level(OK, CRITICAL...).
@@ -51,6 +73,8 @@ func NewStatus(c Cluster) ClusterStatus {
 // Status is an instance of the status package.
 type status struct {
 	c Cluster
+
+	stats cacheStats
 }
 
 // GetStatusFromLocal read the status data and return GetStatusInf from local data.
@@ -110,29 +134,77 @@ func (s *status) ClearStatus(ns, alarmVersion, hostname, tagString string) error
 	return nil
 }
 
-// GenGlobalStatus read status data from cluster, and update the global NsStatus.
-func (s *status) GenGlobalStatus() error {
-	data := make(models.NsStatus)
-	if err := s.genGlobalStatus(&data); err != nil {
-		log.Errorf("HandleStatus get ns fail: %s", err.Error())
+// SetAck acknowledge the not OK status, and update the ack to local status.
+func (s *status) SetAck(ns, alarmVersion, hostname, tagString string, ack models.Ack) error {
+	st, err := s.GetStatusFromCluster(ns, alarmVersion, hostname, tagString)
+	if err != nil || st.Level == "" || st.Level == common.OK {
+		return ErrNotAckable
+	}
+	if ack.Time.IsZero() {
+		ack.Time = time.Now()
+	}
+	ackString, err := ack.String()
+	if err != nil {
 		return err
 	}
+	if err := s.c.Set(AckKey(ns, alarmVersion, hostname, tagString), ackString, &client.SetOptions{}); err != nil {
+		return err
+	}
+	s.setLocalAck(ns, alarmVersion, hostname, tagString, &ack)
+	return nil
+}
 
-	models.StatusMu.Lock()
-	models.StatusData = data
-	models.StatusMu.Unlock()
+// GetAck return the ack of the status from cluster.
+func (s *status) GetAck(ns, alarmVersion, hostname, tagString string) (models.Ack, error) {
+	rep, err := s.c.Get(AckKey(ns, alarmVersion, hostname, tagString), &client.GetOptions{})
+	if err != nil {
+		return models.Ack{}, err
+	}
+	return models.NewAckByString(rep.Node.Value)
+}
+
+// ClearAck remove the ack of the status.
+func (s *status) ClearAck(ns, alarmVersion, hostname, tagString string) error {
+	ackPath := AbsPath(AckKey(ns, alarmVersion, hostname, tagString))
+	if err := s.c.Remove(ackPath); err != nil && !strings.Contains(err.Error(), "Key not found") {
+		return err
+	}
+	s.setLocalAck(ns, alarmVersion, hostname, tagString, nil)
 	return nil
 }
 
-func (s *status) genGlobalStatus(nsStatus *models.NsStatus) error {
+func (s *status) setLocalAck(ns, alarmVersion, hostname, tagString string, ack *models.Ack) {
+	models.StatusMu.Lock()
+	defer models.StatusMu.Unlock()
+	tagStatus, ok := models.StatusData[models.NS(ns)][models.ALARM(alarmVersion)][models.HOST(hostname)]
+	if !ok {
+		return
+	}
+	if st, ok := tagStatus[models.TAG(tagString)]; ok {
+		st.Ack = ack
+		tagStatus[models.TAG(tagString)] = st
+	}
+}
+
+// GenGlobalStatus read status data from cluster, and update the global NsStatus.
+func (s *status) GenGlobalStatus() error {
+	_, err := s.resync()
+	return err
+}
+
+// genGlobalStatus read status data from cluster, return the cluster index of the data.
+func (s *status) genGlobalStatus(nsStatus *models.NsStatus) (uint64, error) {
 	rep, err := s.c.RecursiveGet("")
 	if err != nil {
 		log.Errorf("work HandleStatus get root fail: %s", err.Error())
-		return err
+		return 0, err
 	}
 
 	// ns loop
 	for _, nsNode := range rep.Node.Nodes {
+		if isReservedDir(nsNode.Key) {
+			continue
+		}
 		_ns := models.NS(ReadEtcdLastSplit(nsNode.Key))
 		(*nsStatus)[_ns] = make(map[models.ALARM]models.HostStatus)
 		// ns/alarm loop
@@ -146,23 +218,35 @@ func (s *status) genGlobalStatus(nsStatus *models.NsStatus) error {
 				// ns/alarm/host/tag loop
 				for _, tagNode := range hostNode.Nodes {
 					_tagString := models.TAG(ReadEtcdLastSplit(tagNode.Key))
-					// read status of ns/alarm/host/tag
+					var status models.Status
+					var ack *models.Ack
+					var hasStatus bool
 					for _, statusOrBlockNode := range tagNode.Nodes {
-						if !isStatusPath(statusOrBlockNode.Key) {
-							continue
-						}
-						// read status of ns/alarm/host/tag
-						status, err := models.NewStatusByString(statusOrBlockNode.Value)
-						if err != nil {
-							log.Errorf("unmarshal ns %s alarm %s host %s tag %s status fail: %s", _ns, _alarmVersion, _host, _tagString, err.Error())
-							continue
+						switch {
+						case isStatusPath(statusOrBlockNode.Key):
+							// read status of ns/alarm/host/tag
+							var err error
+							if status, err = models.NewStatusByString(statusOrBlockNode.Value); err != nil {
+								log.Errorf("unmarshal ns %s alarm %s host %s tag %s status fail: %s", _ns, _alarmVersion, _host, _tagString, err.Error())
+								continue
+							}
+							hasStatus = true
+						case isAckPath(statusOrBlockNode.Key):
+							// read ack of ns/alarm/host/tag
+							if _ack, err := models.NewAckByString(statusOrBlockNode.Value); err == nil {
+								ack = &_ack
+							}
 						}
-						status.TagString = string(_tagString)
-						(*nsStatus)[_ns][_alarmVersion][_host][_tagString] = status
 					}
+					if !hasStatus {
+						continue
+					}
+					status.TagString = string(_tagString)
+					status.Ack = ack
+					(*nsStatus)[_ns][_alarmVersion][_host][_tagString] = status
 				}
 			}
 		}
 	}
-	return nil
+	return rep.Index, nil
 }
@@ -0,0 +1,235 @@
+package work
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/metrics"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+
+	"github.com/coreos/etcd/client"
+)
+
+// resyncInterval is the wait before resync the status after the watch fail.
+const resyncInterval = 3 * time.Second
+
+var _ = metrics.NewGaugeFunc("event_status", "Number of status in the local cache by level.", "level", countStatusLevels)
+
+// countStatusLevels return the number of local status per level.
+func countStatusLevels() map[string]float64 {
+	output := make(map[string]float64)
+	models.StatusMu.RLock()
+	defer models.StatusMu.RUnlock()
+	for _, alarmStatus := range models.StatusData {
+		for _, hostStatus := range alarmStatus {
+			for _, tagStatus := range hostStatus {
+				for _, status := range tagStatus {
+					output[status.Level]++
+				}
+			}
+		}
+	}
+	return output
+}
+
+// CacheStats is the state of the local status synced from cluster.
+type CacheStats struct {
+	// Revision is the cluster index the local status applied.
+	Revision uint64 `json:"revision"`
+	// Index is the latest cluster index seen by the watch.
+	Index uint64 `json:"index"`
+	// Behind is the number of cluster index the local status behind.
+	Behind uint64 `json:"behind"`
+	// Lag is the duration from the status updated to applied locally, unit: second.
+	Lag float64 `json:"lag"`
+
+	LastSync  time.Time `json:"lastSync"`
+	LastEvent time.Time `json:"lastEvent"`
+	Resyncs   int       `json:"resyncs"`
+	// Watching is true if the changes are applied by watch, false while resync.
+	Watching bool `json:"watching"`
+}
+
+type cacheStats struct {
+	sync.RWMutex
+	CacheStats
+}
+
+// CacheStats return the state of the local status.
+func (s *status) CacheStats() CacheStats {
+	s.stats.RLock()
+	defer s.stats.RUnlock()
+	output := s.stats.CacheStats
+	if output.Index > output.Revision {
+		output.Behind = output.Index - output.Revision
+	}
+	return output
+}
+
+// WatchGlobalStatus load the global NsStatus from cluster, and then apply the changes by watch.
+// The status is reloaded if the watch fail, such as the watched index is cleared.
+func (s *status) WatchGlobalStatus(ctx context.Context) {
+	for ctx.Err() == nil {
+		index, err := s.resync()
+		if err != nil {
+			sleep(ctx, resyncInterval)
+			continue
+		}
+		if err := s.watch(ctx, index); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if e, ok := err.(client.Error); ok && e.Code == client.ErrorCodeEventIndexCleared {
+				log.Warningf("status watch after index %d is cleared, resync", index)
+			} else {
+				log.Errorf("watch status fail, resync: %s", err.Error())
+				sleep(ctx, resyncInterval)
+			}
+		}
+	}
+}
+
+// resync replace the global NsStatus by the data read from cluster.
+func (s *status) resync() (uint64, error) {
+	data := make(models.NsStatus)
+	index, err := s.genGlobalStatus(&data)
+	if err != nil {
+		log.Errorf("HandleStatus get ns fail: %s", err.Error())
+		return 0, err
+	}
+
+	models.StatusMu.Lock()
+	models.StatusData = data
+	models.StatusMu.Unlock()
+
+	s.stats.Lock()
+	s.stats.Revision, s.stats.Index = index, index
+	s.stats.LastSync = time.Now()
+	s.stats.Resyncs++
+	s.stats.Unlock()
+	return index, nil
+}
+
+// watch apply the changes after index to the global NsStatus until the watch fail.
+func (s *status) watch(ctx context.Context, index uint64) error {
+	s.setWatching(true)
+	defer s.setWatching(false)
+
+	watcher := s.c.Watcher("", index)
+	for {
+		rep, err := watcher.Next(ctx)
+		if err != nil {
+			return err
+		}
+		lag := applyEvent(rep.Action, rep.Node)
+
+		s.stats.Lock()
+		s.stats.Revision = rep.Node.ModifiedIndex
+		if rep.Index > s.stats.Index {
+			s.stats.Index = rep.Index
+		}
+		if s.stats.Revision > s.stats.Index {
+			s.stats.Index = s.stats.Revision
+		}
+		if lag >= 0 {
+			s.stats.Lag = lag.Seconds()
+		}
+		s.stats.LastEvent = time.Now()
+		s.stats.Unlock()
+	}
+}
+
+func (s *status) setWatching(watching bool) {
+	s.stats.Lock()
+	s.stats.Watching = watching
+	s.stats.Unlock()
+}
+
+// applyEvent apply the set/delete/expire event of the node to the global NsStatus.
+// Return the lag of the status if the event set a status, otherwise -1.
+func applyEvent(action string, node *client.Node) time.Duration {
+	rel := strings.TrimPrefix(node.Key, config.GetConfig().Etcd.Path+"/")
+	split := strings.Split(strings.Trim(rel, "/"), "/")
+	if split[0] == "" || isReservedDir(split[0]) {
+		return -1
+	}
+	removed := action == "delete" || action == "expire" || action == "compareAndDelete"
+
+	models.StatusMu.Lock()
+	defer models.StatusMu.Unlock()
+	data := models.StatusData
+	ns := models.NS(split[0])
+	if removed {
+		switch len(split) {
+		case 1:
+			delete(data, ns)
+		case 2:
+			delete(data[ns], models.ALARM(split[1]))
+		case 3:
+			delete(data[ns][models.ALARM(split[1])], models.HOST(split[2]))
+		case 4:
+			delete(data[ns][models.ALARM(split[1])][models.HOST(split[2])], models.TAG(split[3]))
+		case 5:
+			tagStatus := data[ns][models.ALARM(split[1])][models.HOST(split[2])]
+			switch {
+			case isStatusPath(node.Key):
+				delete(tagStatus, models.TAG(split[3]))
+			case isAckPath(node.Key):
+				if st, ok := tagStatus[models.TAG(split[3])]; ok {
+					st.Ack = nil
+					tagStatus[models.TAG(split[3])] = st
+				}
+			}
+		}
+		return -1
+	}
+
+	// make the ns/alarm/host dir of the set key.
+	if _, ok := data[ns]; !ok {
+		data[ns] = make(models.AlarmStatus)
+	}
+	if len(split) < 2 {
+		return -1
+	}
+	alarmVersion := models.ALARM(split[1])
+	if _, ok := data[ns][alarmVersion]; !ok {
+		data[ns][alarmVersion] = make(models.HostStatus)
+	}
+	if len(split) < 3 {
+		return -1
+	}
+	host := models.HOST(split[2])
+	if _, ok := data[ns][alarmVersion][host]; !ok {
+		data[ns][alarmVersion][host] = make(models.TagStatus)
+	}
+	if len(split) != 5 {
+		return -1
+	}
+	tagStatus, tagString := data[ns][alarmVersion][host], models.TAG(split[3])
+	switch {
+	case isStatusPath(node.Key):
+		st, err := models.NewStatusByString(node.Value)
+		if err != nil {
+			log.Errorf("unmarshal ns %s alarm %s host %s tag %s status fail: %s", ns, alarmVersion, host, tagString, err.Error())
+			return -1
+		}
+		st.TagString = string(tagString)
+		st.Ack = tagStatus[tagString].Ack
+		tagStatus[tagString] = st
+		return time.Since(st.UpdateTime)
+	case isAckPath(node.Key):
+		st, ok := tagStatus[tagString]
+		if !ok {
+			return -1
+		}
+		if ack, err := models.NewAckByString(node.Value); err == nil {
+			st.Ack = &ack
+			tagStatus[tagString] = st
+		}
+	}
+	return -1
+}
@@ -0,0 +1,50 @@
+package work
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lodastack/event/config"
+	"github.com/lodastack/event/models"
+	"github.com/lodastack/log"
+	m "github.com/lodastack/models"
+)
+
+var (
+	locations   = make(map[string]*time.Location)
+	locationsMu sync.Mutex
+)
+
+// location return the time zone of alarm active window, use local if not set or invalid.
+func location() *time.Location {
+	name := config.GetConfig().Com.TimeZone
+	if name == "" {
+		return time.Local
+	}
+	locationsMu.Lock()
+	defer locationsMu.Unlock()
+	if loc, ok := locations[name]; ok {
+		return loc
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Errorf("load time zone %s fail, use local: %s", name, err.Error())
+		loc = time.Local
+	}
+	locations[name] = loc
+	return loc
+}
+
+// outOfWindow return the active window of alarm if t is out of it, otherwise return empty.
+// The alarm notify all the time if its starttime/endtime is empty or invalid.
+func outOfWindow(alarm m.Alarm, t time.Time) string {
+	window, ok, err := models.ParseActiveWindow(alarm.STime, alarm.ETime)
+	if err != nil {
+		log.Errorf("parse active window of alarm %s fail: %s", alarm.Version, err.Error())
+		return ""
+	}
+	if !ok || window.Active(t.In(location())) {
+		return ""
+	}
+	return window.String()
+}
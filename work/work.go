@@ -1,13 +1,17 @@
 package work
 
 import (
+	"context"
 	"errors"
 	"strings"
 	"time"
 
 	"github.com/lodastack/event/common"
+	"github.com/lodastack/event/history"
 	"github.com/lodastack/event/loda"
+	"github.com/lodastack/event/metrics"
 	"github.com/lodastack/event/models"
+	"github.com/lodastack/event/stream"
 
 	"github.com/lodastack/log"
 	m "github.com/lodastack/models"
@@ -28,61 +32,123 @@ type Work struct {
 
 	// get/clear block status
 	Block Block
+
+	// manager silences.
+	Silence Silencer
+
+	// manager escalation policies.
+	Escalation Escalator
+
+	// manager on-call schedules.
+	Schedule Scheduler
+
+	// detect flapping status.
+	Flap Flapper
+
+	// elect the leader to run the singleton jobs.
+	Election Elector
+
+	// keep the status transitions, nil if not configured.
+	History *history.Store
 }
 
-func NewWork(c Cluster) *Work {
+// NewWork return Work and start its loops, the loops exit when ctx is done.
+func NewWork(ctx context.Context, c Cluster) *Work {
 	w := &Work{
-		Cluster: c,
-		Status:  NewStatus(c),
-		Block:   NewBlock(c)}
+		Cluster:    c,
+		Status:     NewStatus(c),
+		Block:      NewBlock(c),
+		Silence:    NewSilencer(c),
+		Escalation: NewEscalator(c),
+		Schedule:   NewScheduler(c),
+		Flap:       NewFlapper(c),
+		Election:   NewElector(c)}
+	loda.OnCallResolver = w.Schedule.ResolveGroup
+	w.History = openHistory(ctx)
 
+	go w.Election.CampaignLoop(ctx)
+	go w.Status.WatchGlobalStatus(ctx)
 	go func() {
 		for {
-			if err := w.Status.GenGlobalStatus(); err != nil {
-				log.Errorf("GenGlobalStatus: %s", err)
+			if err := w.Silence.Load(); err != nil {
+				log.Errorf("load silences: %s", err)
+			}
+			if err := w.Schedule.Load(); err != nil {
+				log.Errorf("load schedules: %s", err)
+			}
+			if !sleep(ctx, 10*time.Second) {
+				return
 			}
-			time.Sleep(10 * time.Second)
 		}
 	}()
-	go w.CompareStatusAndLodaLoop()
+	go w.CompareStatusAndLodaLoop(ctx)
+	go w.EscalateLoop(ctx)
 	return w
 }
 
+// Close resign the leader, close the history and the cluster client.
+// It is called on shutdown after the in-flight events are handled.
+func (w *Work) Close() {
+	w.Election.Resign()
+	if w.History != nil {
+		if err := w.History.Close(); err != nil {
+			log.Errorf("close history fail: %s", err.Error())
+		}
+	}
+	if err := w.Cluster.Close(); err != nil {
+		log.Errorf("close cluster fail: %s", err.Error())
+	}
+}
+
+// sleep wait for d, return false if ctx is done before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 // CompareStatusAndLodaLoop is the loop of compare status and loda,
 // create new ns/alarm to etcd and remove the alarm not existed is loda.
-func (w *Work) CompareStatusAndLodaLoop() {
+// Only the leader do the comparison.
+func (w *Work) CompareStatusAndLodaLoop(ctx context.Context) {
 	// wait loda init Loda.NsAlarm finished.
-	for {
-		loda.Alarms.RLock()
-		alarmNum := len(loda.Alarms.NsAlarms)
-		loda.Alarms.RUnlock()
-		if alarmNum != 0 {
-			log.Info("loda resource init finished.")
-			break
+	for !loda.AlarmsLoaded() {
+		if !sleep(ctx, 10*time.Millisecond) {
+			return
 		}
-		time.Sleep(10 * time.Millisecond)
 	}
+	log.Info("loda resource init finished.")
 
 	// read and check NsAlarm.
 	for {
+		if !w.Election.IsLeader() {
+			if !sleep(ctx, heartbeatInterval) {
+				return
+			}
+			continue
+		}
 		if err := w.compareStatusAndLoda(); err != nil {
 			log.Errorf("work loop error: %s", err)
 		} else {
 			log.Info("work loop success")
 		}
 
-		time.Sleep(interval * time.Second)
+		if !sleep(ctx, interval*time.Second) {
+			return
+		}
 	}
 }
 
 // compareStatusAndLoda create dir for new alarm and
 // remove the alarm not exist in loda.
 func (w *Work) compareStatusAndLoda() error {
+	status := statusKeys()
 	loda.Alarms.RLock()
 	defer loda.Alarms.RUnlock()
-	status := models.GetNsStatusFromGlobal("")
-	for _ns := range status {
-		nsInStatus := string(_ns)
+	for nsInStatus, alarmsInStatus := range status {
 		// remove ns not exist in loda.
 		if _, ok := loda.Alarms.NsAlarms[nsInStatus]; !ok {
 			log.Infof("cannot read ns %s on loda, remove it", nsInStatus)
@@ -92,8 +158,7 @@ func (w *Work) compareStatusAndLoda() error {
 			continue
 		}
 
-		for _alarmVersion := range status[_ns] {
-			alarmVersionInStatus := string(_alarmVersion)
+		for alarmVersionInStatus, hostsInStatus := range alarmsInStatus {
 			// remove the alarm if not existed in loda
 			if _, ok := loda.Alarms.NsAlarms[nsInStatus][alarmVersionInStatus]; !ok {
 				log.Infof("Read ns %s alarm %s fail, delete it", nsInStatus, alarmVersionInStatus)
@@ -105,8 +170,7 @@ func (w *Work) compareStatusAndLoda() error {
 			}
 
 			// remove host if not exist in loda
-			for _host := range status[_ns][_alarmVersion] {
-				hostnameInStatus := string(_host)
+			for _, hostnameInStatus := range hostsInStatus {
 				if _, ok := loda.MachineIP(nsInStatus, hostnameInStatus); ok {
 					continue
 				}
@@ -123,7 +187,7 @@ func (w *Work) compareStatusAndLoda() error {
 	// remove the ns/alarm/host from cluster if not exist in loda
 	for nsInLoda, alarms := range loda.Alarms.NsAlarms {
 		// create ns if not exist in etcd.
-		if _, ok := status[models.NS(nsInLoda)]; !ok {
+		if _, ok := status[nsInLoda]; !ok {
 			log.Infof("get ns %s fail, set it", nsInLoda)
 			if err := w.Cluster.Mkdir(nsInLoda); err != nil {
 				log.Errorf("mkdir ns %s error: %s, skip this ns", nsInLoda, err.Error())
@@ -133,7 +197,7 @@ func (w *Work) compareStatusAndLoda() error {
 		// create alarm if not exist in etcd.
 		for _, alarm := range alarms {
 			alarmVersionInLoda := alarm.AlarmData.Version
-			if _, ok := status[models.NS(nsInLoda)][models.ALARM(alarmVersionInLoda)]; !ok {
+			if _, ok := status[nsInLoda][alarmVersionInLoda]; !ok {
 				log.Infof("get ns(%s) alarm(%s) fail, set it and all dir.", nsInLoda, alarmVersionInLoda)
 				alarmKey := AlarmDir(nsInLoda, alarmVersionInLoda)
 				if err := w.Cluster.Mkdir(alarmKey); err != nil {
@@ -145,8 +209,47 @@ func (w *Work) compareStatusAndLoda() error {
 	return nil
 }
 
+// statusKeys copy the ns/alarm/host keys of the status under lock,
+// the status watcher is not blocked by the cluster calls with the copy.
+func statusKeys() map[string]map[string][]string {
+	models.StatusMu.RLock()
+	defer models.StatusMu.RUnlock()
+	keys := make(map[string]map[string][]string, len(models.StatusData))
+	for ns, alarms := range models.StatusData {
+		keys[string(ns)] = make(map[string][]string, len(alarms))
+		for alarmVersion, hosts := range alarms {
+			hostnames := make([]string, 0, len(hosts))
+			for host := range hosts {
+				hostnames = append(hostnames, string(host))
+			}
+			keys[string(ns)][string(alarmVersion)] = hostnames
+		}
+	}
+	return keys
+}
+
+// suppression is why the notify of the event is suppressed.
+type suppression struct {
+	silence  *models.Silence
+	flapping bool
+	// window is the active window of the alarm if the event is out of it.
+	window string
+}
+
+// transition is the status change made by the event.
+type transition struct {
+	// changed is true if the status is new or its level changed.
+	changed bool
+	// oldLevel is the level of the previous status, empty if the status is new.
+	oldLevel string
+	// since is the createtime of the previous status if exist.
+	since time.Time
+	value float64
+}
+
 // Set the status and log the status changes via sdkLog.
-func (w *Work) setStatusAndLogToSDK(ns string, alarm m.Alarm, hostname, ip, level string, receives []string, eventData models.EventData) error {
+// The status is flaged by the suppression of its notify.
+func (w *Work) setStatusAndLogToSDK(ns string, alarm m.Alarm, hostname, ip, level string, receives []string, eventData models.EventData, sup suppression) (transition, error) {
 	now := time.Now().Local()
 	alarmLevel, _ := alarmLevelMap[alarm.Level]
 	newStatus := models.Status{
@@ -165,17 +268,28 @@ func (w *Work) setStatusAndLogToSDK(ns string, alarm m.Alarm, hostname, ip, leve
 		Tags:     (*eventData.Data.Series[0]).Tags,
 		Reciever: loda.GetUserSurmary(receives),
 	}
+	if sup.silence != nil {
+		newStatus.Silenced, newStatus.SilenceID = true, sup.silence.ID
+	}
+	newStatus.Flapping = sup.flapping
+	if sup.window != "" {
+		newStatus.SuppressReason = "out of active window " + sup.window
+	}
 
 	// Set the createtime of status by previous if the status is the same as previous.
 	// Otherwise log the status change via sdkLog.
+	t := transition{since: now, value: newStatus.Value}
 	if oldStatus, err := w.Status.GetStatusFromCluster(ns, alarm.Version, hostname, encodeTags(eventData.Tag())); err != nil {
+		t.changed = true
 		if err := sdkLog.NewStatus(alarm.Name, ns, alarm.Measurement, alarm.Level, hostname, level, receives, newStatus.Value); err != nil {
 			log.Errorf("log status fail: %s", err.Error())
 		}
 	} else {
+		t.since, t.oldLevel = oldStatus.CreateTime, oldStatus.Level
 		if oldStatus.Level == newStatus.Level {
 			newStatus.CreateTime = oldStatus.CreateTime
 		} else {
+			t.changed = true
 			if err := sdkLog.StatusChange(alarm.Name, ns, alarm.Measurement, alarm.Level, hostname, oldStatus.Level, receives, newStatus.Value, oldStatus.CreateTime); err != nil {
 				log.Errorf("log status fail: %s", err.Error())
 			}
@@ -187,16 +301,52 @@ func (w *Work) setStatusAndLogToSDK(ns string, alarm m.Alarm, hostname, ip, leve
 			}
 		}
 	}
-	return w.Status.SetStatus(ns, alarm, hostname, encodeTags(eventData.Tag()), newStatus)
+	if err := w.Status.SetStatus(ns, alarm, hostname, encodeTags(eventData.Tag()), newStatus); err != nil {
+		return t, err
+	}
+	if t.changed {
+		stream.Publish(t.oldLevel, newStatus)
+	}
+	return t, nil
 }
 
-func (w *Work) HandleEvent(ns, alarmversion string, eventData models.EventData) error {
+// HandleEvent handle the event once cluster-wide, the event delivered again is dropped.
+// The event is released to handle again only if it fails before any side effect,
+// otherwise the claim is kept with the failure to not block or notify twice.
+func (w *Work) HandleEvent(ns, alarmversion string, eventData models.EventData) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.HandleEventDuration.Since(start, metrics.Result(err))
+	}()
+
+	id := eventID(ns, alarmversion, eventData)
+	if !w.claimEvent(id) {
+		log.Infof("event %s of ns %s alarm %s is handled already, drop it", eventData.ID, ns, alarmversion)
+		return nil
+	}
+	if err = w.handleEvent(ns, alarmversion, eventData); err != nil {
+		var early earlyError
+		if errors.As(err, &early) {
+			w.releaseEvent(id)
+		} else {
+			log.Errorf("event %s of ns %s alarm %s fail after handled partially, keep the claim: %s",
+				eventData.ID, ns, alarmversion, err.Error())
+			w.markEvent(id, err)
+		}
+	}
+	return err
+}
+
+// earlyError is the error of event before any side effect, the event can be handled again.
+type earlyError struct{ error }
+
+func (w *Work) handleEvent(ns, alarmversion string, eventData models.EventData) (err error) {
 	loda.Alarms.RLock()
 	alarm, ok := loda.Alarms.NsAlarms[ns][alarmversion]
 	loda.Alarms.RUnlock()
 	if !ok {
 		log.Errorf("read ns %s alarm %s alarm data error", ns, alarmversion)
-		return errors.New("event process error: not have alarm data")
+		return earlyError{errors.New("event process error: not have alarm data")}
 	}
 	eventData.Time = eventData.Time.Local()
 	eventData.Ns = ns
@@ -217,41 +367,110 @@ func (w *Work) HandleEvent(ns, alarmversion string, eventData models.EventData)
 	groups := strings.Split(alarm.AlarmData.Groups, ",")
 	reveives := loda.GetGroupUsers(groups)
 
+	// check the event is silenced or not, the status is updated even silenced.
+	var silenced *models.Silence
+	if silence, ok := w.Silence.Match(ns, alarm.AlarmData.Version, alarm.AlarmData.Name, host, eventData.Tag()); ok {
+		silenced = &silence
+	}
+
+	// read the ack before update status, the ack is cleared if level changed or recovered.
+	tagString := encodeTags(eventData.Tag())
+	var acked *models.Ack
+	if ack, err := w.Status.GetAck(ns, alarm.AlarmData.Version, host, tagString); err == nil {
+		acked = &ack
+	}
+
+	// record the level transition, the notify is suppressed while flapping.
+	flapping, flapStarted := w.Flap.Record(ns, alarm.AlarmData.Version, host, tagString, eventData.Level.String())
+
+	// check the event is in the active window of alarm or not.
+	window := outOfWindow(alarm.AlarmData, eventData.Time)
+
 	// update alarm status
-	if err := w.setStatusAndLogToSDK(ns, alarm.AlarmData, host, ip, eventData.Level.String(), reveives, eventData); err != nil {
+	t, err := w.setStatusAndLogToSDK(ns, alarm.AlarmData, host, ip, eventData.Level.String(), reveives, eventData,
+		suppression{silence: silenced, flapping: flapping, window: window})
+	if err != nil {
 		log.Errorf("set ns %s alarm %s host %s fail: %s",
 			ns, alarm.AlarmData.Version, host, err.Error())
 	}
+	eventData.Since = t.since
+
+	// record the transition with the notify outcome.
+	outcome := history.NotifySent
+	if t.changed {
+		defer func() {
+			w.recordTransition(alarm.AlarmData, eventData, t, reveives, outcome, err)
+		}()
+	}
+
+	if acked != nil && (t.changed || eventData.Level.String() == common.OK) {
+		if err := w.Status.ClearAck(ns, alarm.AlarmData.Version, host, tagString); err != nil {
+			log.Errorf("clear ack of ns %s alarm %s host %s fail: %s", ns, alarm.AlarmData.Version, host, err.Error())
+		}
+	}
 
 	// read and check block/times
 	if eventData.Level.String() == common.OK {
 		w.Block.ClearBlock(ns, alarm.AlarmData.Version, host, eventData.Tag())
-		return send(
-			alarm.AlarmData.Name,
-			alarm.AlarmData.Level,
-			alarm.AlarmData.Expression+alarm.AlarmData.Value,
-			common.OK,
-			ip,
-			strings.Split(alarm.AlarmData.Alert, ","),
-			reveives,
-			eventData)
+		if silenced != nil {
+			log.Infof("ns %s alarm %s host %s is silenced by %s, not alert", ns, alarm.AlarmData.Version, host, silenced.ID)
+			outcome = history.NotifySilenced
+			return nil
+		}
+		if window != "" {
+			log.Infof("ns %s alarm %s host %s is out of active window %s, not alert", ns, alarm.AlarmData.Version, host, window)
+			outcome = history.NotifyOutOfWindow
+			return nil
+		}
+		if flapping {
+			outcome = history.NotifyFlapping
+			return sendFlapping(alarm.AlarmData, common.OK, ip, reveives, eventData, flapStarted)
+		}
+		return send(alarm.AlarmData, common.OK, ip, reveives, eventData, acked)
 	}
 
+	if silenced != nil {
+		log.Infof("ns %s alarm %s host %s is silenced by %s, not alert", ns, alarm.AlarmData.Version, host, silenced.ID)
+		outcome = history.NotifySilenced
+		return nil
+	}
+	if window != "" {
+		log.Infof("ns %s alarm %s host %s is out of active window %s, not alert", ns, alarm.AlarmData.Version, host, window)
+		outcome = history.NotifyOutOfWindow
+		return nil
+	}
+	if flapping {
+		outcome = history.NotifyFlapping
+		return sendFlapping(alarm.AlarmData, alarm.AlarmData.Level, ip, reveives, eventData, flapStarted)
+	}
+	if acked != nil && !t.changed {
+		log.Infof("ns %s alarm %s host %s is acked by %s, not alert", ns, alarm.AlarmData.Version, host, acked.User)
+		outcome = history.NotifyAcked
+		return nil
+	}
 	if w.Block.IsBlock(ns, alarm, host, eventData.Tag()) {
+		metrics.BlockDecisions.Inc("blocked")
+		outcome = history.NotifyBlocked
 		return nil
 	}
+	metrics.BlockDecisions.Inc("sent")
 
-	if err := send(
-		alarm.AlarmData.Name,
-		alarm.AlarmData.Level,
-		alarm.AlarmData.Expression+alarm.AlarmData.Value,
-		alarm.AlarmData.Level,
-		ip,
-		strings.Split(alarm.AlarmData.Alert, ","),
-		reveives,
-		eventData); err != nil {
+	if err := send(alarm.AlarmData, alarm.AlarmData.Level, ip, reveives, eventData, nil); err != nil {
 		log.Errorf("handler send event fail: %s", err.Error())
 		return err
 	}
 	return nil
 }
+
+// sendFlapping send a single flapping notice when the status starts flapping,
+// and suppress the notify of every level transition while flapping.
+func sendFlapping(alarm m.Alarm, alertLevel, ip string, recievers []string, eventData models.EventData, started bool) error {
+	host, _ := eventData.Host()
+	if !started {
+		log.Infof("ns %s alarm %s host %s is flapping, not alert", eventData.Ns, alarm.Version, host)
+		return nil
+	}
+	log.Infof("ns %s alarm %s host %s starts flapping", eventData.Ns, alarm.Version, host)
+	alarm.Name = "[flapping] " + alarm.Name
+	return send(alarm, alertLevel, ip, recievers, eventData, nil)
+}